@@ -49,6 +49,15 @@ func (c *Client) Init(ctx context.Context, config *config.Config) error {
 	return nil
 }
 
+// Ping checks that the database is reachable.
+func (c *Client) Ping(ctx context.Context) error {
+	if err := c.DB.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	return nil
+}
+
 func (c *Client) prepareStatements() error {
 	return nil
 }
@@ -0,0 +1,120 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrAlreadyProcessed is returned by WithDedup when the message was already
+// processed.
+var ErrAlreadyProcessed = errors.New("message already processed")
+
+const createProcessedMessages = `
+CREATE TABLE IF NOT EXISTS processed_messages (
+	event        TEXT        NOT NULL,
+	key          TEXT        NOT NULL,
+	processed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (event, key)
+);
+CREATE INDEX IF NOT EXISTS processed_messages_processed_at ON processed_messages (processed_at);`
+
+const insertProcessedMessage = `
+INSERT INTO processed_messages (event, key) VALUES ($1, $2)
+ON CONFLICT (event, key) DO NOTHING`
+
+// CreateDedupTable creates the processed_messages table backing the dedup
+// store, if it does not exist yet.
+func (c *Client) CreateDedupTable(ctx context.Context) error {
+	if _, err := c.DB.ExecContext(ctx, createProcessedMessages); err != nil {
+		return fmt.Errorf("failed to create processed_messages table: %w", err)
+	}
+
+	return nil
+}
+
+// IsProcessed reports whether the message with the given key was already
+// processed for the event.
+func (c *Client) IsProcessed(ctx context.Context, event, key string) (bool, error) {
+	ctx, span := tracer.Start(ctx, "IsProcessed")
+	defer span.End()
+
+	var processed bool
+	err := c.DB.GetContext(ctx, &processed,
+		`SELECT EXISTS (SELECT 1 FROM processed_messages WHERE event = $1 AND key = $2)`,
+		event, key,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up processed message: %w", err)
+	}
+
+	return processed, nil
+}
+
+// MarkProcessed records that the message with the given key was processed
+// for the event. Marking a message twice is not an error.
+func (c *Client) MarkProcessed(ctx context.Context, event, key string) error {
+	ctx, span := tracer.Start(ctx, "MarkProcessed")
+	defer span.End()
+
+	if _, err := c.DB.ExecContext(ctx, insertProcessedMessage, event, key); err != nil {
+		return fmt.Errorf("failed to mark message processed: %w", err)
+	}
+
+	return nil
+}
+
+// WithDedup runs fn in a transaction that also records the message with the
+// given key as processed for the event, so the writes of fn and the dedup
+// record are committed together. It returns ErrAlreadyProcessed without
+// calling fn when the message was already processed.
+func (c *Client) WithDedup(ctx context.Context, event, key string, fn func(tx *sqlx.Tx) error) error {
+	ctx, span := tracer.Start(ctx, "WithDedup")
+	defer span.End()
+
+	tx, err := c.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, insertProcessedMessage, event, key)
+	if err != nil {
+		return fmt.Errorf("failed to mark message processed: %w", err)
+	}
+
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to mark message processed: %w", err)
+	}
+	if inserted == 0 {
+		return ErrAlreadyProcessed
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteProcessedBefore removes the records of messages processed before t
+// and returns how many were removed.
+func (c *Client) DeleteProcessedBefore(ctx context.Context, t time.Time) (int64, error) {
+	ctx, span := tracer.Start(ctx, "DeleteProcessedBefore")
+	defer span.End()
+
+	res, err := c.DB.ExecContext(ctx, `DELETE FROM processed_messages WHERE processed_at < $1`, t)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete processed messages: %w", err)
+	}
+
+	return res.RowsAffected()
+}
@@ -3,7 +3,6 @@ package database
 import (
 	"context"
 	"template-subscriber-go/example"
-	"time"
 
 	"go.opentelemetry.io/otel"
 )
@@ -13,8 +12,14 @@ var tracer = otel.Tracer("database")
 func (c *Client) RecordExampleData(ctx context.Context, exampleData example.Data) error {
 	ctx, span := tracer.Start(ctx, "RecordExampleData")
 	defer span.End()
-	_, cancel := context.WithTimeout(ctx, time.Second*10)
-	defer cancel()
+
+	return nil
+}
+
+// RecordExampleDataBatch records all the example data at once.
+func (c *Client) RecordExampleDataBatch(ctx context.Context, exampleData []example.Data) error {
+	ctx, span := tracer.Start(ctx, "RecordExampleDataBatch")
+	defer span.End()
 
 	return nil
 }
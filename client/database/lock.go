@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+// AdvisoryLock is a Postgres session advisory lock. It is held on a
+// connection of its own, so it is released as soon as that connection is
+// lost and another process may take it.
+type AdvisoryLock struct {
+	client *Client
+	name   string
+	key    int64
+
+	mu   sync.Mutex
+	conn *sql.Conn
+}
+
+// NewAdvisoryLock returns the advisory lock with the given name. Processes
+// using the same name compete for the same lock.
+func (c *Client) NewAdvisoryLock(name string) *AdvisoryLock {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+
+	return &AdvisoryLock{
+		client: c,
+		name:   name,
+		key:    int64(h.Sum64()),
+	}
+}
+
+// TryAcquire reports whether the lock is held by this process, taking it if
+// it is free. A lock held on a connection that was lost is taken again if
+// still free.
+func (l *AdvisoryLock) TryAcquire(ctx context.Context) (bool, error) {
+	ctx, span := tracer.Start(ctx, "TryAcquireAdvisoryLock")
+	defer span.End()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn != nil {
+		if err := l.conn.PingContext(ctx); err == nil {
+			return true, nil
+		}
+		discard(l.conn)
+		l.conn = nil
+	}
+
+	conn, err := l.client.DB.Conn(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get connection for lock %s: %w", l.name, err)
+	}
+
+	var acquired bool
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, l.key).Scan(&acquired)
+	if err != nil {
+		discard(conn)
+		return false, fmt.Errorf("failed to acquire lock %s: %w", l.name, err)
+	}
+	if !acquired {
+		conn.Close()
+		return false, nil
+	}
+
+	l.conn = conn
+	return true, nil
+}
+
+// Release gives the lock up if this process holds it.
+func (l *AdvisoryLock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn == nil {
+		return nil
+	}
+
+	conn := l.conn
+	l.conn = nil
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, l.key); err != nil {
+		discard(conn)
+		return fmt.Errorf("failed to release lock %s: %w", l.name, err)
+	}
+
+	return conn.Close()
+}
+
+// discard closes the underlying connection instead of returning it to the
+// pool, ending its session and any lock held by it.
+func discard(conn *sql.Conn) {
+	_ = conn.Raw(func(any) error {
+		return driver.ErrBadConn
+	})
+}
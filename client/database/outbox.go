@@ -0,0 +1,241 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nuid"
+)
+
+const createOutbox = `
+CREATE TABLE IF NOT EXISTS outbox (
+	id         BIGSERIAL   PRIMARY KEY,
+	subject    TEXT        NOT NULL,
+	header     JSONB       NOT NULL DEFAULT '{}',
+	data       BYTEA       NOT NULL,
+	created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+	sent_at         TIMESTAMPTZ,
+	attempts        INT         NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	last_error      TEXT
+);
+CREATE INDEX IF NOT EXISTS outbox_pending ON outbox (id) WHERE sent_at IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_sent_at ON outbox (sent_at) WHERE sent_at IS NOT NULL;`
+
+// OutboxMessage is a message waiting in the outbox to be published.
+// Attempts is how many times publishing it already failed.
+type OutboxMessage struct {
+	ID        int64
+	Subject   string
+	Header    map[string][]string
+	Data      []byte
+	CreatedAt time.Time
+	Attempts  int
+}
+
+type outboxRow struct {
+	ID        int64     `db:"id"`
+	Subject   string    `db:"subject"`
+	Header    []byte    `db:"header"`
+	Data      []byte    `db:"data"`
+	CreatedAt time.Time `db:"created_at"`
+	Attempts  int       `db:"attempts"`
+}
+
+// OutboxRetry spaces out the attempts to publish an outbox message that
+// keeps failing, so it does not hold back the messages after it.
+type OutboxRetry struct {
+	// MaxAttempts parks a message after that many failed attempts, so it is
+	// no longer relayed until its attempts are reset. Zero means no limit.
+	MaxAttempts int
+	// Delay returns how long to wait before attempting again a message that
+	// failed attempts times.
+	Delay func(attempts int) time.Duration
+}
+
+// CreateOutboxTable creates the outbox table, if it does not exist yet.
+func (c *Client) CreateOutboxTable(ctx context.Context) error {
+	if _, err := c.DB.ExecContext(ctx, createOutbox); err != nil {
+		return fmt.Errorf("failed to create outbox table: %w", err)
+	}
+
+	return nil
+}
+
+// InsertOutbox adds a message to the outbox within tx, so it is published
+// only if tx commits. Messages built with pubsub.NewMsg keep their headers,
+// including the trace context and Nats-Msg-Id. Other messages get a unique
+// Nats-Msg-Id, so the stream drops the copies published by several relays.
+// The outbox is created and relayed by servers set up with
+// server.WithOutbox.
+func (c *Client) InsertOutbox(ctx context.Context, tx *sqlx.Tx, m OutboxMessage) error {
+	ctx, span := tracer.Start(ctx, "InsertOutbox")
+	defer span.End()
+
+	h := nats.Header{}
+	for key, values := range m.Header {
+		h[key] = values
+	}
+	if h.Get(nats.MsgIdHdr) == "" {
+		h.Set(nats.MsgIdHdr, nuid.Next())
+	}
+
+	header, err := json.Marshal(h)
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox message header: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO outbox (subject, header, data) VALUES ($1, $2, $3)`,
+		m.Subject, header, m.Data,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert outbox message: %w", err)
+	}
+
+	return nil
+}
+
+// RelayOutbox locks up to limit pending messages due for an attempt,
+// skipping the ones locked by other relays, and passes them in order to
+// publish. Published messages are marked sent. A failure is recorded on its
+// message, which is attempted again after the delay of retry, or parked
+// once it reached the max attempts, and the later messages are still
+// published. So neither the order of failed messages nor the order across
+// replicas is guaranteed. It returns how many messages were sent, and the
+// first failure if any.
+func (c *Client) RelayOutbox(ctx context.Context, limit int, retry OutboxRetry, publish func(context.Context, OutboxMessage) error) (int, error) {
+	ctx, span := tracer.Start(ctx, "RelayOutbox")
+	defer span.End()
+
+	tx, err := c.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var rows []outboxRow
+	err = tx.SelectContext(ctx, &rows, `
+		SELECT id, subject, header, data, created_at, attempts FROM outbox
+		WHERE sent_at IS NULL
+		AND next_attempt_at <= now()
+		AND ($2 = 0 OR attempts < $2)
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED`,
+		limit, retry.MaxAttempts,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to select outbox messages: %w", err)
+	}
+
+	sent, failed := 0, 0
+	var publishErr error
+	for _, row := range rows {
+		m := OutboxMessage{
+			ID:        row.ID,
+			Subject:   row.Subject,
+			Data:      row.Data,
+			CreatedAt: row.CreatedAt,
+			Attempts:  row.Attempts,
+		}
+		if err := json.Unmarshal(row.Header, &m.Header); err != nil {
+			return sent, fmt.Errorf("failed to unmarshal header of outbox message %d: %w", row.ID, err)
+		}
+
+		if err := publish(ctx, m); err != nil {
+			if err := c.recordOutboxFailure(ctx, tx, row, retry, err); err != nil {
+				return sent, err
+			}
+			if publishErr == nil {
+				publishErr = err
+			}
+			failed++
+			continue
+		}
+
+		_, err := tx.ExecContext(ctx,
+			`UPDATE outbox SET sent_at = now(), attempts = attempts + 1, last_error = NULL WHERE id = $1`,
+			row.ID,
+		)
+		if err != nil {
+			return sent, fmt.Errorf("failed to mark outbox message sent: %w", err)
+		}
+		sent++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if publishErr != nil {
+		return sent, fmt.Errorf("failed to publish %d outbox messages: %w", failed, publishErr)
+	}
+
+	return sent, nil
+}
+
+// recordOutboxFailure records the failed attempt of the outbox message of
+// row and schedules the next one. The message is no longer selected once
+// it reached the max attempts.
+func (c *Client) recordOutboxFailure(ctx context.Context, tx *sqlx.Tx, row outboxRow, retry OutboxRetry, cause error) error {
+	attempts := row.Attempts + 1
+
+	var delay time.Duration
+	if retry.Delay != nil {
+		delay = retry.Delay(attempts)
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		UPDATE outbox SET attempts = $2, last_error = $3,
+		next_attempt_at = now() + make_interval(secs => $4)
+		WHERE id = $1`,
+		row.ID, attempts, cause.Error(), delay.Seconds(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record outbox failure: %w", err)
+	}
+
+	return nil
+}
+
+// OldestPendingOutbox returns when the oldest message not yet sent, parked
+// ones included, entered the outbox. It is the zero time when every message
+// was sent.
+func (c *Client) OldestPendingOutbox(ctx context.Context) (time.Time, error) {
+	ctx, span := tracer.Start(ctx, "OldestPendingOutbox")
+	defer span.End()
+
+	var createdAt time.Time
+	err := c.DB.GetContext(ctx, &createdAt,
+		`SELECT created_at FROM outbox WHERE sent_at IS NULL ORDER BY id LIMIT 1`,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to select oldest pending outbox message: %w", err)
+	}
+
+	return createdAt, nil
+}
+
+// DeleteSentOutboxBefore removes the outbox messages sent before t and
+// returns how many were removed.
+func (c *Client) DeleteSentOutboxBefore(ctx context.Context, t time.Time) (int64, error) {
+	ctx, span := tracer.Start(ctx, "DeleteSentOutboxBefore")
+	defer span.End()
+
+	res, err := c.DB.ExecContext(ctx, `DELETE FROM outbox WHERE sent_at < $1`, t)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete sent outbox messages: %w", err)
+	}
+
+	return res.RowsAffected()
+}
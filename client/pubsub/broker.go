@@ -0,0 +1,47 @@
+package pubsub
+
+import (
+	"context"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Broker is the messaging system events are received from and published
+// to. JetStream is the implementation used in production, MemoryBroker
+// runs the same pipeline without any server.
+type Broker interface {
+	// Subscribe creates or updates the durable consumer described by cfg
+	// on the stream holding subject, and returns a Subscriber fetching its
+	// messages.
+	Subscribe(ctx context.Context, subject string, cfg *nats.ConsumerConfig) (Subscriber, error)
+	// Publish publishes the subject, header and data of msg and waits for
+	// the broker to store it.
+	Publish(ctx context.Context, msg Message) (*nats.PubAck, error)
+}
+
+// asyncBroker is implemented by the brokers able to publish without waiting
+// for each message to be stored.
+type asyncBroker interface {
+	PublishAsync(msg Message) (nats.PubAckFuture, error)
+}
+
+// Subscriber fetches the messages of a durable consumer. The fetched
+// messages are settled through their Ack, Nak, NakWithDelay, Term and
+// InProgress methods.
+type Subscriber interface {
+	// Fetch returns up to batch messages, waiting for some at most until
+	// ctx is done.
+	Fetch(ctx context.Context, batch int) ([]Message, error)
+	// Stats returns how far the consumer is behind.
+	Stats(ctx context.Context) (ConsumerStats, error)
+}
+
+// ConsumerStats is a snapshot of the state of a durable consumer.
+type ConsumerStats struct {
+	// Pending is how many messages were not delivered yet.
+	Pending uint64
+	// AckPending is how many messages were delivered but not acked yet.
+	AckPending int
+	// Redelivered is how many of those were delivered more than once.
+	Redelivered int
+}
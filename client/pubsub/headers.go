@@ -0,0 +1,23 @@
+package pubsub
+
+// HeaderContentType is the header telling how the payload of a message is
+// encoded.
+const HeaderContentType = "Content-Type"
+
+// Content types of message payloads. Messages without a content type are
+// protobuf encoded.
+const (
+	ContentTypeProtobuf  = "application/protobuf"
+	ContentTypeJSON      = "application/json"
+	ContentTypeProtoJSON = "application/protobuf+json"
+)
+
+// Headers set by the Publisher.
+const (
+	// HeaderMessageType holds the full name of the protobuf message.
+	HeaderMessageType = "Message-Type"
+	// HeaderCorrelationID is shared by all messages of a single flow.
+	HeaderCorrelationID = "Correlation-Id"
+	// HeaderCausationID is the id of the message that caused this one.
+	HeaderCausationID = "Causation-Id"
+)
@@ -0,0 +1,114 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+)
+
+// JetStream is the Broker backed by NATS JetStream.
+type JetStream struct {
+	js nats.JetStreamContext
+}
+
+// NewJetStream returns the Broker backed by js.
+func NewJetStream(js nats.JetStreamContext) *JetStream {
+	return &JetStream{js: js}
+}
+
+// Broker returns the JetStream Broker of the client.
+func (c *Client) Broker() Broker {
+	return NewJetStream(c.JetStreamContext)
+}
+
+// Subscribe creates the durable consumer, or updates it so its config
+// matches cfg, and binds a pull subscription to it.
+func (j *JetStream) Subscribe(ctx context.Context, subject string, cfg *nats.ConsumerConfig) (Subscriber, error) {
+	stream, err := j.js.StreamNameBySubject(subject, nats.Context(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("find stream of subject %s: %w", subject, err)
+	}
+
+	_, err = j.js.ConsumerInfo(stream, cfg.Durable, nats.Context(ctx))
+	switch {
+	case errors.Is(err, nats.ErrConsumerNotFound):
+		_, err = j.js.AddConsumer(stream, cfg, nats.Context(ctx))
+	case err == nil:
+		_, err = j.js.UpdateConsumer(stream, cfg, nats.Context(ctx))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create or update consumer: %w", err)
+	}
+
+	// Binding with an empty subject fails, even with several filters
+	filter := cfg.FilterSubject
+	if filter == "" && len(cfg.FilterSubjects) > 0 {
+		filter = cfg.FilterSubjects[0]
+	}
+
+	sub, err := j.js.PullSubscribe(filter, cfg.Durable, nats.Bind(stream, cfg.Durable))
+	if err != nil {
+		return nil, fmt.Errorf("pull subscribe: %w", err)
+	}
+
+	return jetStreamSubscriber{sub: sub}, nil
+}
+
+// Publish publishes msg to its subject. Without a deadline on ctx the
+// default JetStream timeout applies.
+func (j *JetStream) Publish(ctx context.Context, msg Message) (*nats.PubAck, error) {
+	var opts []nats.PubOpt
+	if _, ok := ctx.Deadline(); ok {
+		opts = append(opts, nats.Context(ctx))
+	}
+
+	ack, err := j.js.PublishMsg(msg.natsMsg(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("publish to %s: %w", msg.Subject, err)
+	}
+
+	return ack, nil
+}
+
+// PublishAsync publishes msg to its subject without waiting for the stream
+// to store it.
+func (j *JetStream) PublishAsync(msg Message) (nats.PubAckFuture, error) {
+	future, err := j.js.PublishMsgAsync(msg.natsMsg())
+	if err != nil {
+		return nil, fmt.Errorf("publish to %s: %w", msg.Subject, err)
+	}
+
+	return future, nil
+}
+
+type jetStreamSubscriber struct {
+	sub *nats.Subscription
+}
+
+// Fetch pulls up to batch messages from the consumer.
+func (s jetStreamSubscriber) Fetch(ctx context.Context, batch int) ([]Message, error) {
+	msgs, err := s.sub.Fetch(batch, nats.Context(ctx))
+
+	messages := make([]Message, len(msgs))
+	for i, msg := range msgs {
+		messages[i] = NewMessage(msg)
+	}
+
+	return messages, err
+}
+
+// Stats reads the consumer info.
+func (s jetStreamSubscriber) Stats(_ context.Context) (ConsumerStats, error) {
+	info, err := s.sub.ConsumerInfo()
+	if err != nil {
+		return ConsumerStats{}, err
+	}
+
+	return ConsumerStats{
+		Pending:     info.NumPending,
+		AckPending:  info.NumAckPending,
+		Redelivered: info.NumRedelivered,
+	}, nil
+}
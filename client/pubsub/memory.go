@@ -0,0 +1,430 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// MemoryStream is the name of the single stream of a MemoryBroker.
+const MemoryStream = "memory"
+
+// defaultMemoryAckWait matches the default AckWait of JetStream.
+const defaultMemoryAckWait = 30 * time.Second
+
+var errStaleDelivery = errors.New("message was already settled or redelivered")
+
+// MemoryBroker is a Broker keeping messages in memory, in a single stream
+// holding every subject. It lets the whole receive pipeline run without a
+// server.
+//
+// Like JetStream, its consumers redeliver the messages that are nacked, or
+// not acked within AckWait or the BackOff delay, until they were delivered
+// MaxDeliver times. Messages published with a Nats-Msg-Id already seen are
+// dropped.
+type MemoryBroker struct {
+	mu        sync.Mutex
+	changed   chan struct{} // closed and replaced whenever a fetch may succeed
+	messages  []memoryMessage
+	ids       map[string]uint64 // stream sequence of each Nats-Msg-Id
+	consumers map[string]*memoryConsumer
+}
+
+type memoryMessage struct {
+	subject   string
+	header    nats.Header
+	data      []byte
+	timestamp time.Time
+}
+
+// MemorySettlements counts how the messages delivered to a consumer of a
+// MemoryBroker were settled.
+type MemorySettlements struct {
+	Acked      int
+	Nacked     int
+	Terminated int
+	InProgress int
+}
+
+// NewMemoryBroker returns an empty MemoryBroker.
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		changed:   make(chan struct{}),
+		ids:       map[string]uint64{},
+		consumers: map[string]*memoryConsumer{},
+	}
+}
+
+// Publish appends msg to the stream.
+func (b *MemoryBroker) Publish(_ context.Context, msg Message) (*nats.PubAck, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if id := msg.Header.Get(nats.MsgIdHdr); id != "" {
+		if seq, ok := b.ids[id]; ok {
+			return &nats.PubAck{Stream: MemoryStream, Sequence: seq, Duplicate: true}, nil
+		}
+		b.ids[id] = uint64(len(b.messages) + 1)
+	}
+
+	header := nats.Header{}
+	for key, values := range msg.Header {
+		header[key] = append([]string(nil), values...)
+	}
+
+	b.messages = append(b.messages, memoryMessage{
+		subject:   msg.Subject,
+		header:    header,
+		data:      msg.Data,
+		timestamp: time.Now(),
+	})
+	b.notify()
+
+	return &nats.PubAck{Stream: MemoryStream, Sequence: uint64(len(b.messages))}, nil
+}
+
+// Messages returns the messages published to the subjects matching
+// pattern, in order.
+func (b *MemoryBroker) Messages(pattern string) []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var msgs []Message
+	for i, m := range b.messages {
+		if SubjectMatches(pattern, m.subject) {
+			msgs = append(msgs, Message{
+				Subject:        m.subject,
+				Data:           m.data,
+				Header:         m.header,
+				Stream:         MemoryStream,
+				StreamSequence: uint64(i + 1),
+				Timestamp:      m.timestamp,
+			})
+		}
+	}
+
+	return msgs
+}
+
+// Settlements returns how the messages delivered to the durable consumer
+// were settled so far.
+func (b *MemoryBroker) Settlements(durable string) MemorySettlements {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c, ok := b.consumers[durable]; ok {
+		return c.settlements
+	}
+
+	return MemorySettlements{}
+}
+
+// Subscribe creates the durable consumer, or updates its filters and
+// redelivery settings. The deliver policy only applies on creation.
+func (b *MemoryBroker) Subscribe(_ context.Context, subject string, cfg *nats.ConsumerConfig) (Subscriber, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.consumers[cfg.Durable]
+	if !ok {
+		c = &memoryConsumer{
+			broker:  b,
+			name:    cfg.Durable,
+			next:    b.start(cfg),
+			pending: map[uint64]*memoryDelivery{},
+		}
+		b.consumers[cfg.Durable] = c
+	}
+
+	c.filters = append([]string(nil), cfg.FilterSubjects...)
+	if cfg.FilterSubject != "" {
+		c.filters = append(c.filters, cfg.FilterSubject)
+	}
+	if len(c.filters) == 0 {
+		c.filters = []string{subject}
+	}
+
+	c.ackWait = cfg.AckWait
+	if c.ackWait <= 0 {
+		c.ackWait = defaultMemoryAckWait
+	}
+	c.maxDeliver = cfg.MaxDeliver
+	c.backOff = cfg.BackOff
+
+	return c, nil
+}
+
+// start returns the index of the first message a new consumer delivers.
+func (b *MemoryBroker) start(cfg *nats.ConsumerConfig) int {
+	switch cfg.DeliverPolicy {
+	case nats.DeliverNewPolicy:
+		return len(b.messages)
+	case nats.DeliverLastPolicy:
+		if len(b.messages) > 0 {
+			return len(b.messages) - 1
+		}
+	case nats.DeliverByStartSequencePolicy:
+		if cfg.OptStartSeq > 0 {
+			return int(cfg.OptStartSeq - 1)
+		}
+	case nats.DeliverByStartTimePolicy:
+		if cfg.OptStartTime != nil {
+			return sort.Search(len(b.messages), func(i int) bool {
+				return !b.messages[i].timestamp.Before(*cfg.OptStartTime)
+			})
+		}
+	}
+
+	return 0
+}
+
+// notify wakes up the fetches waiting for messages. It must be called with
+// the lock held.
+func (b *MemoryBroker) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+type memoryConsumer struct {
+	broker     *MemoryBroker
+	name       string
+	filters    []string
+	ackWait    time.Duration
+	maxDeliver int
+	backOff    []time.Duration
+
+	next        int    // index of the first message not delivered yet
+	sequence    uint64 // consumer sequence of the last delivery
+	pending     map[uint64]*memoryDelivery
+	settlements MemorySettlements
+}
+
+// memoryDelivery is a message delivered and not acked yet.
+type memoryDelivery struct {
+	sequence     uint64
+	numDelivered uint64
+	// redeliverAt is when the message is delivered again unless acked
+	redeliverAt time.Time
+}
+
+// Fetch returns the messages due for redelivery first, then new ones.
+func (c *memoryConsumer) Fetch(ctx context.Context, batch int) ([]Message, error) {
+	for {
+		c.broker.mu.Lock()
+		msgs, wake := c.take(batch, time.Now())
+		changed := c.broker.changed
+		c.broker.mu.Unlock()
+
+		if len(msgs) > 0 {
+			return msgs, nil
+		}
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if !wake.IsZero() {
+			timer = time.NewTimer(time.Until(wake))
+			timeout = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-changed:
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// take delivers up to batch messages and returns them, along with when the
+// next redelivery is due. It must be called with the lock held.
+func (c *memoryConsumer) take(batch int, now time.Time) ([]Message, time.Time) {
+	var due []*memoryDelivery
+	for _, d := range c.pending {
+		if d.redeliverAt.After(now) {
+			continue
+		}
+		if c.maxDeliver > 0 && d.numDelivered >= uint64(c.maxDeliver) {
+			delete(c.pending, d.sequence)
+			continue
+		}
+		due = append(due, d)
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].sequence < due[j].sequence
+	})
+
+	var msgs []Message
+	for _, d := range due {
+		if len(msgs) == batch {
+			break
+		}
+		msgs = append(msgs, c.deliver(d, now))
+	}
+
+	for len(msgs) < batch && c.next < len(c.broker.messages) {
+		c.next++
+		if !c.matches(c.broker.messages[c.next-1].subject) {
+			continue
+		}
+
+		d := &memoryDelivery{sequence: uint64(c.next)}
+		c.pending[d.sequence] = d
+		msgs = append(msgs, c.deliver(d, now))
+	}
+
+	var wake time.Time
+	for _, d := range c.pending {
+		if wake.IsZero() || d.redeliverAt.Before(wake) {
+			wake = d.redeliverAt
+		}
+	}
+
+	return msgs, wake
+}
+
+// deliver returns the message of the delivery, counting one more delivery.
+func (c *memoryConsumer) deliver(d *memoryDelivery, now time.Time) Message {
+	d.numDelivered++
+	d.redeliverAt = now.Add(c.wait(d.numDelivered))
+	c.sequence++
+
+	m := c.broker.messages[d.sequence-1]
+	return Message{
+		Subject:          m.subject,
+		Data:             m.data,
+		Header:           m.header,
+		Stream:           MemoryStream,
+		Consumer:         c.name,
+		StreamSequence:   d.sequence,
+		ConsumerSequence: c.sequence,
+		NumDelivered:     d.numDelivered,
+		NumPending:       c.numPending(),
+		Timestamp:        m.timestamp,
+		acker: memoryAcker{
+			consumer:     c,
+			sequence:     d.sequence,
+			numDelivered: d.numDelivered,
+		},
+	}
+}
+
+// wait returns how long a message delivered numDelivered times waits for
+// an ack before it is redelivered.
+func (c *memoryConsumer) wait(numDelivered uint64) time.Duration {
+	if len(c.backOff) == 0 {
+		return c.ackWait
+	}
+
+	i := int(numDelivered) - 1
+	if i >= len(c.backOff) {
+		i = len(c.backOff) - 1
+	}
+
+	return c.backOff[i]
+}
+
+func (c *memoryConsumer) matches(subject string) bool {
+	for _, filter := range c.filters {
+		if SubjectMatches(filter, subject) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// numPending counts the messages not delivered yet. It must be called with
+// the lock held.
+func (c *memoryConsumer) numPending() uint64 {
+	var n uint64
+	for _, m := range c.broker.messages[c.next:] {
+		if c.matches(m.subject) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Stats counts the pending and unacked messages of the consumer.
+func (c *memoryConsumer) Stats(_ context.Context) (ConsumerStats, error) {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+
+	stats := ConsumerStats{
+		Pending:    c.numPending(),
+		AckPending: len(c.pending),
+	}
+	for _, d := range c.pending {
+		if d.numDelivered > 1 {
+			stats.Redelivered++
+		}
+	}
+
+	return stats, nil
+}
+
+// memoryAcker settles one delivery of a message. Settling a delivery that
+// was already settled or redelivered fails.
+type memoryAcker struct {
+	consumer     *memoryConsumer
+	sequence     uint64
+	numDelivered uint64
+}
+
+func (a memoryAcker) Ack() error {
+	return a.settle(func(c *memoryConsumer, _ *memoryDelivery) {
+		delete(c.pending, a.sequence)
+		c.settlements.Acked++
+	})
+}
+
+func (a memoryAcker) Nak() error {
+	return a.NakWithDelay(0)
+}
+
+func (a memoryAcker) NakWithDelay(delay time.Duration) error {
+	return a.settle(func(c *memoryConsumer, d *memoryDelivery) {
+		d.redeliverAt = time.Now().Add(delay)
+		c.settlements.Nacked++
+	})
+}
+
+func (a memoryAcker) Term() error {
+	return a.settle(func(c *memoryConsumer, _ *memoryDelivery) {
+		delete(c.pending, a.sequence)
+		c.settlements.Terminated++
+	})
+}
+
+func (a memoryAcker) InProgress() error {
+	return a.settle(func(c *memoryConsumer, d *memoryDelivery) {
+		d.redeliverAt = time.Now().Add(c.wait(d.numDelivered))
+		c.settlements.InProgress++
+	})
+}
+
+func (a memoryAcker) settle(fn func(*memoryConsumer, *memoryDelivery)) error {
+	c := a.consumer
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+
+	d, ok := c.pending[a.sequence]
+	if !ok || d.numDelivered != a.numDelivered {
+		return errStaleDelivery
+	}
+
+	fn(c, d)
+	c.broker.notify()
+
+	return nil
+}
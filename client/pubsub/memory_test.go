@@ -0,0 +1,400 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// subscribe creates a durable consumer of subject on b.
+func subscribe(t *testing.T, b *MemoryBroker, subject string, cfg nats.ConsumerConfig) Subscriber {
+	t.Helper()
+
+	if cfg.Durable == "" {
+		cfg.Durable = "test"
+	}
+
+	sub, err := b.Subscribe(context.Background(), subject, &cfg)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	return sub
+}
+
+// publish publishes a message with data to subject on b.
+func publish(t *testing.T, b *MemoryBroker, subject, data string) *nats.PubAck {
+	t.Helper()
+
+	ack, err := b.Publish(context.Background(), Message{Subject: subject, Data: []byte(data)})
+	if err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	return ack
+}
+
+// fetch fetches up to batch messages, waiting at most wait for some.
+func fetch(t *testing.T, sub Subscriber, batch int, wait time.Duration) []Message {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+
+	msgs, err := sub.Fetch(ctx, batch)
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("fetch: %v", err)
+	}
+
+	return msgs
+}
+
+// fetchOne fetches a single message, failing the test when none comes.
+func fetchOne(t *testing.T, sub Subscriber, wait time.Duration) Message {
+	t.Helper()
+
+	msgs := fetch(t, sub, 1, wait)
+	if len(msgs) != 1 {
+		t.Fatalf("got %d messages, want 1", len(msgs))
+	}
+
+	return msgs[0]
+}
+
+// fetchNone fails the test when a message comes within wait.
+func fetchNone(t *testing.T, sub Subscriber, wait time.Duration) {
+	t.Helper()
+
+	if msgs := fetch(t, sub, 1, wait); len(msgs) != 0 {
+		t.Fatalf("got message %s delivered %d times, want none", msgs[0].Data, msgs[0].NumDelivered)
+	}
+}
+
+func TestMemoryBrokerFetchAndAck(t *testing.T) {
+	b := NewMemoryBroker()
+	sub := subscribe(t, b, "orders.>", nats.ConsumerConfig{})
+
+	for i := 1; i <= 3; i++ {
+		publish(t, b, fmt.Sprintf("orders.%d", i), fmt.Sprint(i))
+	}
+	publish(t, b, "payments.1", "other")
+
+	msgs := fetch(t, sub, 10, time.Second)
+	if len(msgs) != 3 {
+		t.Fatalf("got %d messages, want 3", len(msgs))
+	}
+	for i, msg := range msgs {
+		if want := fmt.Sprint(i + 1); string(msg.Data) != want {
+			t.Errorf("message %d: got data %s, want %s", i, msg.Data, want)
+		}
+		if msg.Stream != MemoryStream || msg.Consumer != "test" {
+			t.Errorf("message %d: got stream %s consumer %s", i, msg.Stream, msg.Consumer)
+		}
+		if msg.NumDelivered != 1 {
+			t.Errorf("message %d: got %d deliveries, want 1", i, msg.NumDelivered)
+		}
+		if msg.ConsumerSequence != uint64(i+1) {
+			t.Errorf("message %d: got consumer sequence %d, want %d", i, msg.ConsumerSequence, i+1)
+		}
+	}
+	if msgs[2].StreamSequence != 3 {
+		t.Errorf("got stream sequence %d, want 3", msgs[2].StreamSequence)
+	}
+
+	for _, msg := range msgs {
+		if err := msg.Ack(); err != nil {
+			t.Fatalf("ack: %v", err)
+		}
+	}
+
+	stats, err := sub.Stats(context.Background())
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if stats != (ConsumerStats{}) {
+		t.Errorf("got stats %+v, want none pending", stats)
+	}
+	if got := b.Settlements("test"); got != (MemorySettlements{Acked: 3}) {
+		t.Errorf("got settlements %+v, want 3 acked", got)
+	}
+}
+
+func TestMemoryBrokerNak(t *testing.T) {
+	b := NewMemoryBroker()
+	sub := subscribe(t, b, "orders", nats.ConsumerConfig{AckWait: time.Minute})
+	publish(t, b, "orders", "1")
+
+	msg := fetchOne(t, sub, time.Second)
+	if err := msg.Nak(); err != nil {
+		t.Fatalf("nak: %v", err)
+	}
+
+	msg = fetchOne(t, sub, time.Second)
+	if msg.NumDelivered != 2 {
+		t.Errorf("got %d deliveries, want 2", msg.NumDelivered)
+	}
+
+	stats, _ := sub.Stats(context.Background())
+	if stats.AckPending != 1 || stats.Redelivered != 1 {
+		t.Errorf("got stats %+v, want 1 ack pending and redelivered", stats)
+	}
+}
+
+func TestMemoryBrokerNakWithDelay(t *testing.T) {
+	b := NewMemoryBroker()
+	sub := subscribe(t, b, "orders", nats.ConsumerConfig{AckWait: time.Minute})
+	publish(t, b, "orders", "1")
+
+	msg := fetchOne(t, sub, time.Second)
+	if err := msg.NakWithDelay(200 * time.Millisecond); err != nil {
+		t.Fatalf("nak: %v", err)
+	}
+
+	fetchNone(t, sub, 100*time.Millisecond)
+	if msg = fetchOne(t, sub, time.Second); msg.NumDelivered != 2 {
+		t.Errorf("got %d deliveries, want 2", msg.NumDelivered)
+	}
+}
+
+func TestMemoryBrokerAckWait(t *testing.T) {
+	b := NewMemoryBroker()
+	sub := subscribe(t, b, "orders", nats.ConsumerConfig{AckWait: 200 * time.Millisecond})
+	publish(t, b, "orders", "1")
+
+	fetchOne(t, sub, time.Second)
+
+	fetchNone(t, sub, 100*time.Millisecond)
+	if msg := fetchOne(t, sub, time.Second); msg.NumDelivered != 2 {
+		t.Errorf("got %d deliveries, want 2", msg.NumDelivered)
+	}
+}
+
+func TestMemoryBrokerInProgress(t *testing.T) {
+	b := NewMemoryBroker()
+	sub := subscribe(t, b, "orders", nats.ConsumerConfig{AckWait: 200 * time.Millisecond})
+	publish(t, b, "orders", "1")
+
+	msg := fetchOne(t, sub, time.Second)
+
+	// Each call resets the ack wait, so the message is never redelivered
+	for i := 0; i < 3; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if err := msg.InProgress(); err != nil {
+			t.Fatalf("in progress: %v", err)
+		}
+	}
+	fetchNone(t, sub, 100*time.Millisecond)
+
+	if err := msg.Ack(); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+}
+
+func TestMemoryBrokerBackOff(t *testing.T) {
+	b := NewMemoryBroker()
+	sub := subscribe(t, b, "orders", nats.ConsumerConfig{
+		AckWait: time.Minute,
+		BackOff: []time.Duration{100 * time.Millisecond, 300 * time.Millisecond},
+	})
+	publish(t, b, "orders", "1")
+
+	// Each delay is measured from before the fetch of the previous
+	// delivery, which happened no earlier, so it is never underestimated
+	start := time.Now()
+	fetchOne(t, sub, time.Second)
+
+	// The first delay of the backoff replaces the ack wait
+	previous := time.Now()
+	msg := fetchOne(t, sub, time.Second)
+	if msg.NumDelivered != 2 {
+		t.Fatalf("got %d deliveries, want 2", msg.NumDelivered)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("redelivered after %s, want at least 100ms", elapsed)
+	}
+
+	// The last one applies to every further delivery
+	for n := uint64(3); n <= 4; n++ {
+		start = previous
+		fetchNone(t, sub, 200*time.Millisecond)
+		previous = time.Now()
+		if msg = fetchOne(t, sub, time.Second); msg.NumDelivered != n {
+			t.Fatalf("got %d deliveries, want %d", msg.NumDelivered, n)
+		}
+		if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+			t.Errorf("redelivered after %s, want at least 300ms", elapsed)
+		}
+	}
+}
+
+func TestMemoryBrokerMaxDeliver(t *testing.T) {
+	b := NewMemoryBroker()
+	sub := subscribe(t, b, "orders", nats.ConsumerConfig{
+		AckWait:    time.Minute,
+		MaxDeliver: 2,
+	})
+	publish(t, b, "orders", "1")
+
+	for n := uint64(1); n <= 2; n++ {
+		msg := fetchOne(t, sub, time.Second)
+		if msg.NumDelivered != n {
+			t.Fatalf("got %d deliveries, want %d", msg.NumDelivered, n)
+		}
+		if err := msg.Nak(); err != nil {
+			t.Fatalf("nak: %v", err)
+		}
+	}
+
+	fetchNone(t, sub, 100*time.Millisecond)
+
+	stats, _ := sub.Stats(context.Background())
+	if stats.AckPending != 0 {
+		t.Errorf("got %d ack pending, want 0", stats.AckPending)
+	}
+}
+
+func TestMemoryBrokerUnlimitedMaxDeliver(t *testing.T) {
+	b := NewMemoryBroker()
+	sub := subscribe(t, b, "orders", nats.ConsumerConfig{
+		AckWait:    time.Minute,
+		MaxDeliver: -1,
+	})
+	publish(t, b, "orders", "1")
+
+	for n := uint64(1); n <= 5; n++ {
+		msg := fetchOne(t, sub, time.Second)
+		if msg.NumDelivered != n {
+			t.Fatalf("got %d deliveries, want %d", msg.NumDelivered, n)
+		}
+		_ = msg.Nak()
+	}
+}
+
+func TestMemoryBrokerTerm(t *testing.T) {
+	b := NewMemoryBroker()
+	sub := subscribe(t, b, "orders", nats.ConsumerConfig{AckWait: 100 * time.Millisecond})
+	publish(t, b, "orders", "1")
+
+	msg := fetchOne(t, sub, time.Second)
+	if err := msg.Term(); err != nil {
+		t.Fatalf("term: %v", err)
+	}
+
+	fetchNone(t, sub, 200*time.Millisecond)
+	if got := b.Settlements("test"); got != (MemorySettlements{Terminated: 1}) {
+		t.Errorf("got settlements %+v, want 1 terminated", got)
+	}
+}
+
+func TestMemoryBrokerStaleDelivery(t *testing.T) {
+	b := NewMemoryBroker()
+	sub := subscribe(t, b, "orders", nats.ConsumerConfig{AckWait: 100 * time.Millisecond})
+	publish(t, b, "orders", "1")
+
+	first := fetchOne(t, sub, time.Second)
+	second := fetchOne(t, sub, time.Second)
+
+	// The first delivery was replaced by the redelivery
+	if err := first.Ack(); !errors.Is(err, errStaleDelivery) {
+		t.Errorf("ack of a redelivered message: got %v, want %v", err, errStaleDelivery)
+	}
+
+	if err := second.Ack(); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if err := second.Ack(); !errors.Is(err, errStaleDelivery) {
+		t.Errorf("second ack: got %v, want %v", err, errStaleDelivery)
+	}
+	if err := second.Nak(); !errors.Is(err, errStaleDelivery) {
+		t.Errorf("nak after ack: got %v, want %v", err, errStaleDelivery)
+	}
+
+	if got := b.Settlements("test"); got != (MemorySettlements{Acked: 1}) {
+		t.Errorf("got settlements %+v, want 1 acked", got)
+	}
+}
+
+func TestMemoryBrokerDuplicates(t *testing.T) {
+	b := NewMemoryBroker()
+
+	msg := Message{
+		Subject: "orders",
+		Data:    []byte("1"),
+		Header:  nats.Header{nats.MsgIdHdr: []string{"order-1"}},
+	}
+
+	first, err := b.Publish(context.Background(), msg)
+	if err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	second, err := b.Publish(context.Background(), msg)
+	if err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	if first.Duplicate || !second.Duplicate {
+		t.Errorf("got duplicates %t and %t, want only the second one", first.Duplicate, second.Duplicate)
+	}
+	if second.Sequence != first.Sequence {
+		t.Errorf("got sequence %d for the duplicate, want %d", second.Sequence, first.Sequence)
+	}
+	if msgs := b.Messages("orders"); len(msgs) != 1 {
+		t.Errorf("got %d messages stored, want 1", len(msgs))
+	}
+}
+
+func TestMemoryBrokerDeliverPolicy(t *testing.T) {
+	b := NewMemoryBroker()
+	publish(t, b, "orders", "1")
+	publish(t, b, "orders", "2")
+	publish(t, b, "orders", "3")
+
+	tests := []struct {
+		name string
+		cfg  nats.ConsumerConfig
+		want string
+	}{
+		{"all", nats.ConsumerConfig{DeliverPolicy: nats.DeliverAllPolicy}, "1"},
+		{"last", nats.ConsumerConfig{DeliverPolicy: nats.DeliverLastPolicy}, "3"},
+		{"by start sequence", nats.ConsumerConfig{DeliverPolicy: nats.DeliverByStartSequencePolicy, OptStartSeq: 2}, "2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Durable = tt.name
+			sub := subscribe(t, b, "orders", tt.cfg)
+
+			if msg := fetchOne(t, sub, time.Second); string(msg.Data) != tt.want {
+				t.Errorf("got first message %s, want %s", msg.Data, tt.want)
+			}
+		})
+	}
+
+	t.Run("new", func(t *testing.T) {
+		sub := subscribe(t, b, "orders", nats.ConsumerConfig{Durable: "new", DeliverPolicy: nats.DeliverNewPolicy})
+		fetchNone(t, sub, 50*time.Millisecond)
+
+		publish(t, b, "orders", "4")
+		if msg := fetchOne(t, sub, time.Second); string(msg.Data) != "4" {
+			t.Errorf("got message %s, want 4", msg.Data)
+		}
+	})
+}
+
+func TestMemoryBrokerFetchWaitsForPublish(t *testing.T) {
+	b := NewMemoryBroker()
+	sub := subscribe(t, b, "orders", nats.ConsumerConfig{})
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_, _ = b.Publish(context.Background(), Message{Subject: "orders", Data: []byte("1")})
+	}()
+
+	if msg := fetchOne(t, sub, time.Second); string(msg.Data) != "1" {
+		t.Errorf("got message %s, want 1", msg.Data)
+	}
+}
@@ -0,0 +1,158 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// ErrNotReceived is returned when settling a message that was not received
+// from a Broker.
+var ErrNotReceived = errors.New("message was not received from a broker")
+
+// Acker settles a received message with its broker.
+type Acker interface {
+	Ack() error
+	Nak() error
+	NakWithDelay(delay time.Duration) error
+	Term() error
+	InProgress() error
+}
+
+// Message is a message received from a Broker with its headers and
+// delivery metadata.
+type Message struct {
+	Subject string
+	Data    []byte
+	Header  nats.Header
+
+	Stream           string
+	Consumer         string
+	StreamSequence   uint64
+	ConsumerSequence uint64
+	// NumDelivered is how many times the message was delivered, this one
+	// included.
+	NumDelivered uint64
+	// NumPending is how many messages were left for the consumer.
+	NumPending uint64
+	// Timestamp is when the message was published to the stream.
+	Timestamp time.Time
+
+	acker Acker
+}
+
+// NewMessage returns the Message of a message fetched from JetStream.
+// The metadata is left empty for messages that did not come from JetStream.
+func NewMessage(msg *nats.Msg) Message {
+	m := Message{
+		Subject: msg.Subject,
+		Data:    msg.Data,
+		Header:  msg.Header,
+		acker:   natsAcker{msg},
+	}
+
+	meta, err := msg.Metadata()
+	if err != nil {
+		return m
+	}
+
+	m.Stream = meta.Stream
+	m.Consumer = meta.Consumer
+	m.StreamSequence = meta.Sequence.Stream
+	m.ConsumerSequence = meta.Sequence.Consumer
+	m.NumDelivered = meta.NumDelivered
+	m.NumPending = meta.NumPending
+	m.Timestamp = meta.Timestamp
+
+	return m
+}
+
+// natsMsg returns the subject, data and headers of m as a message to
+// publish.
+func (m Message) natsMsg() *nats.Msg {
+	msg := nats.NewMsg(m.Subject)
+	msg.Data = m.Data
+	for key, values := range m.Header {
+		msg.Header[key] = values
+	}
+
+	return msg
+}
+
+// Ack tells the broker the message was handled.
+func (m Message) Ack() error {
+	if m.acker == nil {
+		return ErrNotReceived
+	}
+	return m.acker.Ack()
+}
+
+// Nak tells the broker to redeliver the message right away.
+func (m Message) Nak() error {
+	if m.acker == nil {
+		return ErrNotReceived
+	}
+	return m.acker.Nak()
+}
+
+// NakWithDelay tells the broker to redeliver the message after delay.
+func (m Message) NakWithDelay(delay time.Duration) error {
+	if m.acker == nil {
+		return ErrNotReceived
+	}
+	return m.acker.NakWithDelay(delay)
+}
+
+// Term tells the broker to never redeliver the message.
+func (m Message) Term() error {
+	if m.acker == nil {
+		return ErrNotReceived
+	}
+	return m.acker.Term()
+}
+
+// InProgress tells the broker the message is still being handled,
+// resetting its ack wait.
+func (m Message) InProgress() error {
+	if m.acker == nil {
+		return ErrNotReceived
+	}
+	return m.acker.InProgress()
+}
+
+// natsAcker settles a message fetched from JetStream.
+type natsAcker struct {
+	msg *nats.Msg
+}
+
+func (a natsAcker) Ack() error                             { return a.msg.Ack() }
+func (a natsAcker) Nak() error                             { return a.msg.Nak() }
+func (a natsAcker) NakWithDelay(delay time.Duration) error { return a.msg.NakWithDelay(delay) }
+func (a natsAcker) Term() error                            { return a.msg.Term() }
+func (a natsAcker) InProgress() error                      { return a.msg.InProgress() }
+
+// ID identifies the message for deduplication. It is the Nats-Msg-Id header
+// set by the publisher, or the stream and sequence of the message.
+func (m Message) ID() string {
+	if id := m.Header.Get(nats.MsgIdHdr); id != "" {
+		return id
+	}
+
+	return fmt.Sprintf("%s:%d", m.Stream, m.StreamSequence)
+}
+
+type messageKey struct{}
+
+// WithMessage returns a copy of ctx carrying the message being handled.
+func WithMessage(ctx context.Context, m Message) context.Context {
+	return context.WithValue(ctx, messageKey{}, m)
+}
+
+// MessageFromContext returns the message being handled, if any.
+func MessageFromContext(ctx context.Context) (Message, bool) {
+	m, ok := ctx.Value(messageKey{}).(Message)
+	return m, ok
+}
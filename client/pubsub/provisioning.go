@@ -0,0 +1,341 @@
+package pubsub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	"template-subscriber-go/config"
+)
+
+// Provisioning declares the streams and durable consumers the service
+// needs. It is read from a YAML or JSON file.
+type Provisioning struct {
+	Streams []StreamSpec `yaml:"streams"`
+}
+
+// StreamSpec declares a stream. Fields left out keep the value the server
+// already has, or get the server default when the stream is created.
+type StreamSpec struct {
+	Name       string         `yaml:"name"`
+	Subjects   []string       `yaml:"subjects"`
+	Retention  string         `yaml:"retention"` // limits, interest or workqueue
+	Storage    string         `yaml:"storage"`   // file or memory
+	Replicas   int            `yaml:"replicas"`
+	MaxAge     time.Duration  `yaml:"max_age"`
+	MaxBytes   int64          `yaml:"max_bytes"`
+	Duplicates time.Duration  `yaml:"duplicates"`
+	Consumers  []ConsumerSpec `yaml:"consumers"`
+}
+
+// ConsumerSpec declares a durable pull consumer of a stream. Fields left out
+// keep the value the server already has.
+type ConsumerSpec struct {
+	Durable        string        `yaml:"durable"`
+	AckWait        time.Duration `yaml:"ack_wait"`
+	MaxAckPending  int           `yaml:"max_ack_pending"`
+	FilterSubjects []string      `yaml:"filter_subjects"`
+}
+
+// defaultProvisioning is used when no provisioning file is configured.
+var defaultProvisioning = Provisioning{
+	Streams: []StreamSpec{
+		{
+			Name:     "example",
+			Subjects: []string{"example"},
+		},
+	},
+}
+
+// LoadProvisioning reads a provisioning file. JSON is valid YAML, so both
+// formats are accepted.
+func LoadProvisioning(path string) (*Provisioning, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read provisioning file: %w", err)
+	}
+
+	var p Provisioning
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parse provisioning file %s: %w", path, err)
+	}
+
+	return &p, nil
+}
+
+func (c *Client) provision(js nats.JetStreamContext, config *config.Config) error {
+	p := defaultProvisioning
+	if config.NatsProvisioningFile != "" {
+		loaded, err := LoadProvisioning(config.NatsProvisioningFile)
+		if err != nil {
+			return err
+		}
+		p = *loaded
+	}
+
+	// Messages that exceeded their max deliveries are published here
+	if !p.hasStream(config.NatsDeadLetterStream) {
+		p.Streams = append(p.Streams, StreamSpec{
+			Name:     config.NatsDeadLetterStream,
+			Subjects: []string{config.NatsDeadLetterStream + ".>"},
+		})
+	}
+
+	return Reconcile(js, &p, config.NatsProvisioningDryRun)
+}
+
+func (p *Provisioning) hasStream(name string) bool {
+	for _, stream := range p.Streams {
+		if stream.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Reconcile creates the declared streams and consumers that are missing and
+// updates the ones whose config drifted. Every difference is logged. In dry
+// run mode the differences are only logged. A drift of the stream retention
+// or storage, which the server cannot update, is only reported.
+func Reconcile(js nats.JetStreamContext, p *Provisioning, dryRun bool) error {
+	for _, stream := range p.Streams {
+		if err := reconcileStream(js, stream, dryRun); err != nil {
+			return fmt.Errorf("stream %s: %w", stream.Name, err)
+		}
+
+		for _, consumer := range stream.Consumers {
+			if err := reconcileConsumer(js, stream.Name, consumer, dryRun); err != nil {
+				return fmt.Errorf("stream %s consumer %s: %w", stream.Name, consumer.Durable, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func reconcileStream(js nats.JetStreamContext, spec StreamSpec, dryRun bool) error {
+	logger := log.WithField("stream", spec.Name).WithField("dry_run", dryRun)
+
+	info, err := js.StreamInfo(spec.Name)
+	if err != nil && !errors.Is(err, nats.ErrStreamNotFound) {
+		return err
+	}
+
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		cfg := nats.StreamConfig{Name: spec.Name}
+		changes, err := spec.apply(&cfg)
+		if err != nil {
+			return err
+		}
+
+		logger.WithField("changes", changes).Info("Creating stream")
+		if dryRun {
+			return nil
+		}
+
+		_, err = js.AddStream(&cfg)
+		return err
+	}
+
+	cfg := info.Config
+	changes, err := spec.apply(&cfg)
+	if err != nil {
+		return err
+	}
+
+	// The server refuses to update these fields, changing them means
+	// recreating the stream, so the drift is reported and left alone
+	if fixed := changes.only(notUpdatableStreamFields...); len(fixed) > 0 {
+		logger.WithField("changes", fixed).Warn("Stream fields drifted but cannot be updated, recreate the stream to apply them")
+		cfg.Retention, cfg.Storage = info.Config.Retention, info.Config.Storage
+		changes = changes.without(notUpdatableStreamFields...)
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	logger.WithField("changes", changes).Info("Updating drifted stream")
+	if dryRun {
+		return nil
+	}
+
+	_, err = js.UpdateStream(&cfg)
+	return err
+}
+
+func reconcileConsumer(js nats.JetStreamContext, stream string, spec ConsumerSpec, dryRun bool) error {
+	logger := log.WithField("stream", stream).WithField("consumer", spec.Durable).WithField("dry_run", dryRun)
+
+	info, err := js.ConsumerInfo(stream, spec.Durable)
+	if err != nil && !errors.Is(err, nats.ErrConsumerNotFound) {
+		return err
+	}
+
+	if errors.Is(err, nats.ErrConsumerNotFound) {
+		cfg := nats.ConsumerConfig{
+			Durable:   spec.Durable,
+			AckPolicy: nats.AckExplicitPolicy,
+		}
+		changes := spec.apply(&cfg)
+
+		logger.WithField("changes", changes).Info("Creating consumer")
+		if dryRun {
+			return nil
+		}
+
+		_, err = js.AddConsumer(stream, &cfg)
+		return err
+	}
+
+	cfg := info.Config
+	changes := spec.apply(&cfg)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	logger.WithField("changes", changes).Info("Updating drifted consumer")
+	if dryRun {
+		return nil
+	}
+
+	_, err = js.UpdateConsumer(stream, &cfg)
+	return err
+}
+
+// apply sets the declared fields on cfg and returns what changed.
+func (s StreamSpec) apply(cfg *nats.StreamConfig) (changes, error) {
+	var d changes
+
+	if len(s.Subjects) > 0 {
+		d.add("subjects", cfg.Subjects, s.Subjects)
+		cfg.Subjects = s.Subjects
+	}
+	if s.Retention != "" {
+		var retention nats.RetentionPolicy
+		if err := parseEnum(&retention, s.Retention); err != nil {
+			return nil, fmt.Errorf("retention: %w", err)
+		}
+		d.add("retention", cfg.Retention, retention)
+		cfg.Retention = retention
+	}
+	if s.Storage != "" {
+		var storage nats.StorageType
+		if err := parseEnum(&storage, s.Storage); err != nil {
+			return nil, fmt.Errorf("storage: %w", err)
+		}
+		d.add("storage", cfg.Storage, storage)
+		cfg.Storage = storage
+	}
+	if s.Replicas > 0 {
+		d.add("replicas", cfg.Replicas, s.Replicas)
+		cfg.Replicas = s.Replicas
+	}
+	if s.MaxAge > 0 {
+		d.add("max_age", cfg.MaxAge, s.MaxAge)
+		cfg.MaxAge = s.MaxAge
+	}
+	if s.MaxBytes != 0 {
+		d.add("max_bytes", cfg.MaxBytes, s.MaxBytes)
+		cfg.MaxBytes = s.MaxBytes
+	}
+	if s.Duplicates > 0 {
+		d.add("duplicates", cfg.Duplicates, s.Duplicates)
+		cfg.Duplicates = s.Duplicates
+	}
+
+	return d, nil
+}
+
+// apply sets the declared fields on cfg and returns what changed.
+func (s ConsumerSpec) apply(cfg *nats.ConsumerConfig) []string {
+	var d changes
+
+	if s.AckWait > 0 {
+		d.add("ack_wait", cfg.AckWait, s.AckWait)
+		cfg.AckWait = s.AckWait
+	}
+	if s.MaxAckPending != 0 {
+		d.add("max_ack_pending", cfg.MaxAckPending, s.MaxAckPending)
+		cfg.MaxAckPending = s.MaxAckPending
+	}
+	if len(s.FilterSubjects) > 0 {
+		current := cfg.FilterSubjects
+		if cfg.FilterSubject != "" {
+			current = []string{cfg.FilterSubject}
+		}
+		d.add("filter_subjects", current, s.FilterSubjects)
+		SetFilterSubjects(cfg, s.FilterSubjects)
+	}
+
+	return d
+}
+
+// SetFilterSubjects sets the filters of the consumer config, using the
+// single subject field when possible so servers older than 2.10 accept it.
+func SetFilterSubjects(cfg *nats.ConsumerConfig, subjects []string) {
+	cfg.FilterSubject, cfg.FilterSubjects = "", nil
+	if len(subjects) == 1 {
+		cfg.FilterSubject = subjects[0]
+		return
+	}
+	cfg.FilterSubjects = subjects
+}
+
+// notUpdatableStreamFields are the stream fields the server refuses to
+// update.
+var notUpdatableStreamFields = []string{"retention", "storage"}
+
+// changes lists config fields whose value differs, as "field: old -> new".
+type changes []string
+
+func (c *changes) add(field string, from, to interface{}) {
+	if reflect.DeepEqual(from, to) {
+		return
+	}
+	*c = append(*c, fmt.Sprintf("%s: %v -> %v", field, from, to))
+}
+
+// only returns the changes of the fields.
+func (c changes) only(fields ...string) changes {
+	var d changes
+	for _, change := range c {
+		if c.of(change, fields) {
+			d = append(d, change)
+		}
+	}
+	return d
+}
+
+// without returns the changes of the other fields.
+func (c changes) without(fields ...string) changes {
+	var d changes
+	for _, change := range c {
+		if !c.of(change, fields) {
+			d = append(d, change)
+		}
+	}
+	return d
+}
+
+func (changes) of(change string, fields []string) bool {
+	for _, field := range fields {
+		if strings.HasPrefix(change, field+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseEnum parses one of the nats policy names into its type.
+func parseEnum(dst json.Unmarshaler, value string) error {
+	return dst.UnmarshalJSON([]byte(strconv.Quote(value)))
+}
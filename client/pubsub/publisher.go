@@ -0,0 +1,238 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"template-subscriber-go/monitoring/trace"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+var tracer = otel.Tracer("pubsub")
+
+// Publisher publishes protobuf messages through a Broker.
+//
+// Every message carries the trace context of ctx, a Nats-Msg-Id the stream
+// uses for deduplication, its content type and message type, and
+// correlation and causation ids. When published while handling a message,
+// the correlation id is carried over from that message and the causation id
+// is its id.
+type Publisher struct {
+	broker Broker
+}
+
+// NewPublisher returns a Publisher on top of the broker.
+func NewPublisher(broker Broker) *Publisher {
+	return &Publisher{broker: broker}
+}
+
+// PublishOption configures a single publish.
+type PublishOption func(*publishOptions)
+
+type publishOptions struct {
+	msgID         string
+	correlationID string
+	causationID   string
+	contentType   string
+	header        nats.Header
+}
+
+// WithMsgID sets the Nats-Msg-Id of the message. Publishing twice with the
+// same id within the duplicates window of the stream stores it once. It
+// defaults to a unique id.
+func WithMsgID(id string) PublishOption {
+	return func(o *publishOptions) {
+		o.msgID = id
+	}
+}
+
+// WithCorrelationID sets the correlation id of the message.
+func WithCorrelationID(id string) PublishOption {
+	return func(o *publishOptions) {
+		o.correlationID = id
+	}
+}
+
+// WithCausationID sets the causation id of the message.
+func WithCausationID(id string) PublishOption {
+	return func(o *publishOptions) {
+		o.causationID = id
+	}
+}
+
+// WithContentType sets how the message is encoded. It defaults to
+// protobuf, ContentTypeProtoJSON is also supported.
+func WithContentType(contentType string) PublishOption {
+	return func(o *publishOptions) {
+		o.contentType = contentType
+	}
+}
+
+// WithHeader adds a header to the message.
+func WithHeader(key, value string) PublishOption {
+	return func(o *publishOptions) {
+		o.header.Add(key, value)
+	}
+}
+
+// Publish publishes msg to subject and waits for the stream to store it.
+func (p *Publisher) Publish(ctx context.Context, subject string, msg proto.Message, opts ...PublishOption) (*nats.PubAck, error) {
+	ctx, span := tracer.Start(ctx, "Publish "+subject)
+	defer span.End()
+
+	m, err := NewMsg(ctx, subject, msg, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	ack, err := p.PublishMsg(ctx, m)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return ack, nil
+}
+
+// PublishAsync publishes msg to subject without waiting. The returned future
+// resolves once the stream stored the message or failed to. Brokers unable
+// to publish asynchronously publish in the background.
+func (p *Publisher) PublishAsync(ctx context.Context, subject string, msg proto.Message, opts ...PublishOption) (nats.PubAckFuture, error) {
+	ctx, span := tracer.Start(ctx, "PublishAsync "+subject)
+	defer span.End()
+
+	m, err := NewMsg(ctx, subject, msg, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	async, ok := p.broker.(asyncBroker)
+	if !ok {
+		return p.publishInBackground(m), nil
+	}
+
+	future, err := async.PublishAsync(messageOf(m))
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return future, nil
+}
+
+// publishInBackground publishes m in a goroutine and returns the future of
+// its ack.
+func (p *Publisher) publishInBackground(m *nats.Msg) nats.PubAckFuture {
+	f := &pubAckFuture{
+		msg: m,
+		ok:  make(chan *nats.PubAck, 1),
+		err: make(chan error, 1),
+	}
+
+	go func() {
+		ack, err := p.broker.Publish(context.Background(), messageOf(m))
+		if err != nil {
+			f.err <- err
+			return
+		}
+		f.ok <- ack
+	}()
+
+	return f
+}
+
+// pubAckFuture resolves once a publish running in the background returned.
+type pubAckFuture struct {
+	msg *nats.Msg
+	ok  chan *nats.PubAck
+	err chan error
+}
+
+func (f *pubAckFuture) Ok() <-chan *nats.PubAck { return f.ok }
+func (f *pubAckFuture) Err() <-chan error       { return f.err }
+func (f *pubAckFuture) Msg() *nats.Msg          { return f.msg }
+
+// PublishMsg publishes a message built beforehand, such as with NewMsg, and
+// waits for the stream to store it. Without a deadline on ctx the default
+// timeout of the broker applies.
+func (p *Publisher) PublishMsg(ctx context.Context, m *nats.Msg) (*nats.PubAck, error) {
+	return p.broker.Publish(ctx, messageOf(m))
+}
+
+// messageOf returns the subject, data and headers of m as a Message.
+func messageOf(m *nats.Msg) Message {
+	return Message{
+		Subject: m.Subject,
+		Data:    m.Data,
+		Header:  m.Header,
+	}
+}
+
+// NewMsg encodes msg and returns it as a message to subject with all the
+// headers set by the Publisher.
+func NewMsg(ctx context.Context, subject string, msg proto.Message, opts ...PublishOption) (*nats.Msg, error) {
+	o := publishOptions{
+		contentType: ContentTypeProtobuf,
+		header:      nats.Header{},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var data []byte
+	var err error
+	switch o.contentType {
+	case ContentTypeProtobuf:
+		data, err = proto.Marshal(msg)
+	case ContentTypeProtoJSON:
+		data, err = protojson.Marshal(msg)
+	default:
+		return nil, fmt.Errorf("unsupported content type %q", o.contentType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s: %w", msg.ProtoReflect().Descriptor().FullName(), err)
+	}
+
+	m := nats.NewMsg(subject)
+	m.Data = data
+	for key, values := range o.header {
+		m.Header[key] = values
+	}
+
+	if o.msgID == "" {
+		o.msgID = nuid.Next()
+	}
+
+	// Carry the flow over from the message being handled, if any
+	if cause, ok := MessageFromContext(ctx); ok {
+		if o.correlationID == "" {
+			o.correlationID = cause.Header.Get(HeaderCorrelationID)
+		}
+		if o.correlationID == "" {
+			o.correlationID = cause.ID()
+		}
+		if o.causationID == "" {
+			o.causationID = cause.ID()
+		}
+	}
+	if o.correlationID == "" {
+		o.correlationID = o.msgID
+	}
+
+	m.Header.Set(nats.MsgIdHdr, o.msgID)
+	m.Header.Set(HeaderContentType, o.contentType)
+	m.Header.Set(HeaderMessageType, string(msg.ProtoReflect().Descriptor().FullName()))
+	m.Header.Set(HeaderCorrelationID, o.correlationID)
+	if o.causationID != "" {
+		m.Header.Set(HeaderCausationID, o.causationID)
+	}
+
+	trace.InjectIntoCarrier(ctx, propagation.HeaderCarrier(m.Header))
+
+	return m, nil
+}
@@ -2,6 +2,8 @@ package pubsub
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	"github.com/nats-io/nats.go"
 
@@ -11,11 +13,21 @@ import (
 // Client holds the PubSub client.
 type Client struct {
 	nats.JetStreamContext
+	Conn *nats.Conn
+
+	closed chan struct{}
 }
 
 // Init sets up a new pubsub client.
 func (c *Client) Init(ctx context.Context, config *config.Config) error {
-	nc, err := nats.Connect(config.NatsURL)
+	c.closed = make(chan struct{})
+
+	nc, err := nats.Connect(config.NatsURL,
+		nats.DrainTimeout(config.ShutdownTimeout),
+		nats.ClosedHandler(func(_ *nats.Conn) {
+			close(c.closed)
+		}),
+	)
 	if err != nil {
 		return err
 	}
@@ -25,45 +37,59 @@ func (c *Client) Init(ctx context.Context, config *config.Config) error {
 		return err
 	}
 
-	if err := c.createStreams(js); err != nil {
+	if err := c.provision(js, config); err != nil {
 		return err
 	}
 
 	c.JetStreamContext = js
+	c.Conn = nc
 	return nil
 }
 
-func (c *Client) createStreams(js nats.JetStreamContext) error {
-
-	type streamConf struct {
-		Name     string
-		Subjects []string
+// CheckConnection returns an error unless the NATS connection is up.
+func (c *Client) CheckConnection(ctx context.Context) error {
+	if status := c.Conn.Status(); status != nats.CONNECTED {
+		return fmt.Errorf("nats connection is %s", status)
 	}
 
-	streams := []streamConf{
-		{
-			Name:     "example",
-			Subjects: []string{"example"},
-		},
+	return nil
+}
+
+// CheckNotClosed returns an error once the NATS connection is closed for
+// good, because it ran out of reconnect attempts or was drained.
+func (c *Client) CheckNotClosed(ctx context.Context) error {
+	select {
+	case <-c.closed:
+		return errors.New("nats connection is closed")
+	default:
+		return nil
 	}
+}
 
-	for _, stream := range streams {
-		_, err := js.StreamInfo(stream.Name)
-		if err != nil {
-			if err == nats.ErrStreamNotFound {
-				_, err = js.AddStream(&nats.StreamConfig{
-					Name:     stream.Name,
-					Subjects: stream.Subjects,
-				})
-
-				if err != nil {
-					return err
-				}
-			} else {
-				return err
-			}
-		}
+// CheckJetStream returns an error unless the JetStream account can be
+// reached.
+func (c *Client) CheckJetStream(ctx context.Context) error {
+	if _, err := c.AccountInfo(nats.Context(ctx)); err != nil {
+		return fmt.Errorf("jetstream account info: %w", err)
 	}
 
 	return nil
 }
+
+// Drain flushes pending acks and publishes, unsubscribes and closes the
+// connection. It blocks until the connection is closed. When ctx is done
+// first the connection is closed right away, dropping what was not flushed.
+func (c *Client) Drain(ctx context.Context) error {
+	if err := c.Conn.Drain(); err != nil {
+		return fmt.Errorf("drain nats connection: %w", err)
+	}
+
+	select {
+	case <-c.closed:
+		return nil
+	case <-ctx.Done():
+		c.Conn.Close()
+		<-c.closed
+		return fmt.Errorf("drain nats connection: %w", ctx.Err())
+	}
+}
@@ -3,7 +3,11 @@ package main
 import (
 	"context"
 	"template-subscriber-go/config"
+	"template-subscriber-go/example"
+	"template-subscriber-go/example/pb/fakeapi"
 	"template-subscriber-go/server"
+	"template-subscriber-go/server/event"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -23,12 +27,33 @@ func main() {
 		log.Fatal(err.Error())
 	}
 
-	var s server.Server
+	s := server.New(
+		server.WithConfig(config),
+		// The example event is idempotent, see WithMiddlewares below
+		server.WithDedup(),
+	)
 
-	if err := s.Create(ctx, config); err != nil {
+	if err := s.Create(ctx); err != nil {
 		log.Fatal(err.Error())
 	}
 
+	// Register your events here
+	s.RegisterPubSub("Example", "example", "example",
+		event.TypedHandler[*fakeapi.FakeData]{
+			Handler: example.Handler{
+				DB: s.DB,
+			},
+		},
+		event.WithRetryPolicy(event.RetryPolicy{
+			InitialDelay: time.Second,
+			Multiplier:   2,
+			MaxDelay:     time.Minute,
+			Jitter:       0.2,
+		}),
+		event.WithMaxDeliver(10),
+		event.WithMiddlewares(event.Idempotent(s.DB, nil)),
+	)
+
 	errc := make(chan error, 1)
 
 	go func(errc chan error) {
@@ -2,6 +2,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
 	log "github.com/sirupsen/logrus"
@@ -25,6 +27,50 @@ type Config struct {
 	DatabaseMaxConnections     int     `envconfig:"DATABASE_MAX_CONNECTIONS" default:"12"`
 	DatabaseMaxIdleConnections int     `envconfig:"DATABASE_MAX_IDLE_CONNECTIONS" default:"3"`
 	NatsURL                    string  `envconfig:"NATS_URL" required:"true"`
+	NatsDeadLetterStream       string  `envconfig:"NATS_DEAD_LETTER_STREAM" default:"dead-letter"`
+	NatsProvisioningFile       string  `envconfig:"NATS_PROVISIONING_FILE"`
+	NatsProvisioningDryRun     bool    `envconfig:"NATS_PROVISIONING_DRY_RUN" default:"false"`
+
+	// ShutdownTimeout bounds how long the server takes to stop after a
+	// shutdown signal: in-flight messages are handled within the first four
+	// fifths of it, and the NATS connection drains within what is left. It
+	// must stay below the termination grace period of the orchestrator.
+	ShutdownTimeout time.Duration `envconfig:"SHUTDOWN_TIMEOUT" default:"25s"`
+
+	// IdempotencyTTL is how long processed message records are kept for
+	// deduplication, and IdempotencyCleanupEvery how often older ones are
+	// removed.
+	IdempotencyTTL          time.Duration `envconfig:"IDEMPOTENCY_TTL" default:"72h"`
+	IdempotencyCleanupEvery time.Duration `envconfig:"IDEMPOTENCY_CLEANUP_EVERY" default:"1h"`
+
+	// Outbox relay settings. Every OutboxRelayEvery up to OutboxBatchSize
+	// pending messages are published, within OutboxRelayTimeout, and sent
+	// ones older than OutboxRetention are removed every OutboxCleanupEvery.
+	// A message failing to publish is attempted again after a delay
+	// doubling from OutboxRetryDelay up to OutboxMaxRetryDelay, and parked
+	// after OutboxMaxAttempts, zero meaning never.
+	OutboxRelayEvery    time.Duration `envconfig:"OUTBOX_RELAY_EVERY" default:"1s"`
+	OutboxRelayTimeout  time.Duration `envconfig:"OUTBOX_RELAY_TIMEOUT" default:"30s"`
+	OutboxBatchSize     int           `envconfig:"OUTBOX_BATCH_SIZE" default:"100"`
+	OutboxMaxAttempts   int           `envconfig:"OUTBOX_MAX_ATTEMPTS" default:"20"`
+	OutboxRetryDelay    time.Duration `envconfig:"OUTBOX_RETRY_DELAY" default:"1s"`
+	OutboxMaxRetryDelay time.Duration `envconfig:"OUTBOX_MAX_RETRY_DELAY" default:"5m"`
+	OutboxRetention     time.Duration `envconfig:"OUTBOX_RETENTION" default:"72h"`
+	OutboxCleanupEvery  time.Duration `envconfig:"OUTBOX_CLEANUP_EVERY" default:"1h"`
+
+	// HealthCheckTimeout bounds each check of the readiness probe.
+	HealthCheckTimeout time.Duration `envconfig:"HEALTH_CHECK_TIMEOUT" default:"2s"`
+
+	// Default receiver settings for pubsub events. Each PubSubEvent may
+	// override them.
+	PubSubWorkers      int           `envconfig:"PUBSUB_WORKERS" default:"10"`
+	PubSubQueueSize    int           `envconfig:"PUBSUB_QUEUE_SIZE" default:"1"`
+	PubSubFetchBatch   int           `envconfig:"PUBSUB_FETCH_BATCH" default:"10"`
+	PubSubFetchMaxWait time.Duration `envconfig:"PUBSUB_FETCH_MAX_WAIT" default:"50ms"`
+	PubSubPanicPolicy  string        `envconfig:"PUBSUB_PANIC_POLICY" default:"nak"`
+	PubSubAckWait      time.Duration `envconfig:"PUBSUB_ACK_WAIT" default:"30s"`
+	PubSubTimeout      time.Duration `envconfig:"PUBSUB_TIMEOUT" default:"25s"`
+	PubSubStatsEvery   time.Duration `envconfig:"PUBSUB_STATS_EVERY" default:"15s"`
 }
 
 // LoadConfig reads environment variables and populates Config.
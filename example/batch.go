@@ -0,0 +1,48 @@
+package example
+
+import (
+	"context"
+	"fmt"
+	"template-subscriber-go/client/pubsub"
+	"template-subscriber-go/example/pb/fakeapi"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// BatchHandler handles the example event in batches. Use it as the
+// BatchHandler of a PubSubEvent.
+type BatchHandler struct {
+	DB BatchDataRecorder
+}
+
+// HandleBatch records all the example data of the batch at once.
+func (e BatchHandler) HandleBatch(ctx context.Context, msgs []pubsub.Message) []error {
+	errs := make([]error, len(msgs))
+	exampleData := make([]Data, 0, len(msgs))
+	decoded := make([]int, 0, len(msgs))
+
+	for i, msg := range msgs {
+		fakeData := &fakeapi.FakeData{}
+		if err := proto.Unmarshal(msg.Data, fakeData); err != nil {
+			errs[i] = ErrNonRecoverable{
+				Err: fmt.Errorf("failed to unmarshal example data: %w", err),
+			}
+			continue
+		}
+
+		exampleData = append(exampleData, Data{
+			IsFake: fakeData.IsFake,
+			Date:   fakeData.GetDate().AsTime(),
+		})
+		decoded = append(decoded, i)
+	}
+
+	// Do stuff here
+	if err := e.DB.RecordExampleDataBatch(ctx, exampleData); err != nil {
+		for _, i := range decoded {
+			errs[i] = err
+		}
+	}
+
+	return errs
+}
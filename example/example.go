@@ -8,11 +8,16 @@ import (
 // Data contains example data indicating if the data is fake
 // or not.
 type Data struct {
-	IsFake bool      `json:"isFake"`
-	Date   time.Time `json:"date"`
+	IsFake bool      `json:"isFake" db:"is_fake"`
+	Date   time.Time `json:"date" db:"date"`
 }
 
 // DataRecorder is an interface for recording example data.
 type DataRecorder interface {
 	RecordExampleData(ctx context.Context, exampleData Data) error
 }
+
+// BatchDataRecorder is an interface for recording example data in bulk.
+type BatchDataRecorder interface {
+	RecordExampleDataBatch(ctx context.Context, exampleData []Data) error
+}
@@ -0,0 +1,27 @@
+package example
+
+import (
+	"context"
+	"template-subscriber-go/example/pb/fakeapi"
+)
+
+// Handler handles the example event.
+type Handler struct {
+	DB DataRecorder
+}
+
+// Handle is the handler for the example event.
+func (e Handler) Handle(ctx context.Context, fakeData *fakeapi.FakeData) error {
+	exampleData := Data{
+		IsFake: fakeData.IsFake,
+		Date:   fakeData.GetDate().AsTime(),
+	}
+
+	// Do stuff here
+	err := e.DB.RecordExampleData(ctx, exampleData)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+// Package health runs the checks behind the liveness and readiness probes.
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Status values of a check and of a whole report.
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Checker reports whether a dependency of the service is healthy.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc lets an ordinary function be used as a Checker.
+type CheckerFunc func(ctx context.Context) error
+
+// Check calls f(ctx).
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Registry holds the named checks of the service.
+type Registry struct {
+	timeout time.Duration
+
+	mu     sync.RWMutex
+	checks map[string]Checker
+	info   map[string]func() any
+}
+
+// Result is the outcome of a single check.
+type Result struct {
+	Status  string `json:"status"`
+	Latency string `json:"latency"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Report is the outcome of all the checks in a registry.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+	Info   map[string]any    `json:"info,omitempty"`
+}
+
+// NewRegistry returns an empty registry whose checks each get timeout to
+// complete.
+func NewRegistry(timeout time.Duration) *Registry {
+	return &Registry{
+		timeout: timeout,
+		checks:  map[string]Checker{},
+		info:    map[string]func() any{},
+	}
+}
+
+// Register adds a check, replacing any check with the same name.
+func (r *Registry) Register(name string, c Checker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.checks[name] = c
+}
+
+// RegisterInfo adds information reported alongside the checks without
+// affecting the status, replacing any information with the same name.
+func (r *Registry) RegisterInfo(name string, info func() any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.info[name] = info
+}
+
+// Run runs all checks concurrently. The report fails if any check fails.
+func (r *Registry) Run(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := make(map[string]Checker, len(r.checks))
+	for name, c := range r.checks {
+		checks[name] = c
+	}
+	info := make(map[string]func() any, len(r.info))
+	for name, f := range r.info {
+		info[name] = f
+	}
+	r.mu.RUnlock()
+
+	report := Report{
+		Status: StatusOK,
+		Checks: make(map[string]Result, len(checks)),
+	}
+	if len(info) > 0 {
+		report.Info = make(map[string]any, len(info))
+		for name, f := range info {
+			report.Info[name] = f()
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, c := range checks {
+		wg.Add(1)
+		go func(name string, c Checker) {
+			defer wg.Done()
+
+			result := r.run(ctx, c)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			if result.Status != StatusOK {
+				report.Status = StatusFail
+			}
+		}(name, c)
+	}
+	wg.Wait()
+
+	return report
+}
+
+func (r *Registry) run(ctx context.Context, c Checker) Result {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.Check(ctx)
+	result := Result{
+		Status:  StatusOK,
+		Latency: time.Since(start).String(),
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+
+	return result
+}
@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+
+	api "go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// ConsumerStats is a snapshot of the state of the durable consumer of an
+// event.
+type ConsumerStats struct {
+	Pending     uint64
+	AckPending  int
+	Redelivered int
+}
+
+var (
+	handlersInFlight api.Int64UpDownCounter = noop.Int64UpDownCounter{}
+
+	observed = struct {
+		sync.Mutex
+		consumers map[string]ConsumerStats
+		queues    map[string]func() int
+	}{
+		consumers: map[string]ConsumerStats{},
+		queues:    map[string]func() int{},
+	}
+)
+
+// registerConsumerInstruments sets up the gauges following how far
+// subscribers are behind.
+func registerConsumerInstruments(meter api.Meter) error {
+	var err error
+
+	handlersInFlight, err = meter.Int64UpDownCounter("handlers_in_flight",
+		api.WithDescription("Number of messages being handled right now."),
+		api.WithUnit("{message}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	pending, err := meter.Int64ObservableGauge("consumer_pending",
+		api.WithDescription("Number of messages in the stream not yet delivered to the consumer."),
+		api.WithUnit("{message}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	ackPending, err := meter.Int64ObservableGauge("consumer_ack_pending",
+		api.WithDescription("Number of messages delivered to the consumer but not yet acked."),
+		api.WithUnit("{message}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	redelivered, err := meter.Int64ObservableGauge("consumer_redelivered",
+		api.WithDescription("Number of messages redelivered to the consumer and not yet acked."),
+		api.WithUnit("{message}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	queueOccupancy, err := meter.Int64ObservableGauge("worker_queue_occupancy",
+		api.WithDescription("Number of fetched messages waiting for a free worker."),
+		api.WithUnit("{message}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o api.Observer) error {
+		observed.Lock()
+		defer observed.Unlock()
+
+		for event, stats := range observed.consumers {
+			opt := eventAttributes(event)
+			o.ObserveInt64(pending, int64(stats.Pending), opt)
+			o.ObserveInt64(ackPending, int64(stats.AckPending), opt)
+			o.ObserveInt64(redelivered, int64(stats.Redelivered), opt)
+		}
+
+		for event, length := range observed.queues {
+			opt := eventAttributes(event)
+			o.ObserveInt64(queueOccupancy, int64(length()), opt)
+		}
+
+		return nil
+	}, pending, ackPending, redelivered, queueOccupancy)
+
+	return err
+}
+
+// SetConsumerStats stores the latest consumer stats of an event, which
+// are reported on the next collection.
+func SetConsumerStats(event string, stats ConsumerStats) {
+	observed.Lock()
+	defer observed.Unlock()
+
+	observed.consumers[event] = stats
+}
+
+// RegisterWorkerQueue reports the occupancy of the worker queue of an event
+// type by calling length on every collection.
+func RegisterWorkerQueue(event string, length func() int) {
+	observed.Lock()
+	defer observed.Unlock()
+
+	observed.queues[event] = length
+}
+
+// HandlerStarted records that n messages of the event are being handled.
+func HandlerStarted(ctx context.Context, event string, n int64) {
+	handlersInFlight.Add(ctx, n, eventAttributes(event))
+}
+
+// HandlerFinished records that n messages of the event are done.
+func HandlerFinished(ctx context.Context, event string, n int64) {
+	handlersInFlight.Add(ctx, -n, eventAttributes(event))
+}
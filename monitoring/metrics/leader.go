@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+
+	api "go.opentelemetry.io/otel/metric"
+)
+
+var leaders = struct {
+	sync.Mutex
+	events map[string]bool
+}{
+	events: map[string]bool{},
+}
+
+// registerLeaderInstruments sets up the gauge telling which app events this
+// replica is the leader of.
+func registerLeaderInstruments(meter api.Meter) error {
+	leader, err := meter.Int64ObservableGauge("app_event_leader",
+		api.WithDescription("Whether this replica is the leader running the app event, 1 or 0."),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o api.Observer) error {
+		leaders.Lock()
+		defer leaders.Unlock()
+
+		for event, isLeader := range leaders.events {
+			var v int64
+			if isLeader {
+				v = 1
+			}
+			o.ObserveInt64(leader, v, eventAttributes(event))
+		}
+
+		return nil
+	}, leader)
+
+	return err
+}
+
+// SetLeader records whether this replica is the leader of the app event.
+func SetLeader(event string, isLeader bool) {
+	leaders.Lock()
+	defer leaders.Unlock()
+
+	leaders.events[event] = isLeader
+}
@@ -1,8 +1,13 @@
 // Package metrics sets up and handles our prometheus collectors.
+//
+// Every metric about events carries an "event" label with the event name.
+// The processing metrics also carry an "outcome" label telling how handling
+// the message ended.
 package metrics
 
 import (
 	"context"
+	"sync"
 	"template-subscriber-go/config"
 
 	"go.opentelemetry.io/otel"
@@ -11,13 +16,53 @@ import (
 
 	"go.opentelemetry.io/otel/exporters/prometheus"
 	api "go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
 	"go.opentelemetry.io/otel/sdk/metric"
 )
 
+// Outcome is how handling a message ended.
+type Outcome string
+
+const (
+	// OutcomeAck means the message was handled successfully.
+	OutcomeAck Outcome = "ack"
+	// OutcomeNak means the message failed with a recoverable error and
+	// will be redelivered.
+	OutcomeNak Outcome = "nak"
+	// OutcomeTerm means the message failed with a non-recoverable error, or
+	// was moved to the dead letter subject, and will not be redelivered.
+	OutcomeTerm Outcome = "term"
+	// OutcomeExpectedError means the handler returned an expected error.
+	OutcomeExpectedError Outcome = "expected_error"
+	// OutcomePanic means the handler panicked.
+	OutcomePanic Outcome = "panic"
+	// OutcomeTimeout means the handler ran past its deadline.
+	OutcomeTimeout Outcome = "timeout"
+)
+
+const taskDuration = "task_duration"
+
+// The instruments record nothing until MetricsProvider sets them up, so
+// events can also be handled without metrics, such as in tests.
 var (
-	messagesReceived api.Int64Counter
-	errorsOccurred   api.Int64Counter
-	timeToProcess    api.Float64Histogram
+	messagesReceived api.Int64Counter     = noop.Int64Counter{}
+	errorsOccurred   api.Int64Counter     = noop.Int64Counter{}
+	handlerPanics    api.Int64Counter     = noop.Int64Counter{}
+	timeToProcess    api.Float64Histogram = noop.Float64Histogram{}
+
+	provider    *metric.MeterProvider
+	serviceName string
+
+	// Events with their own task_duration histogram, keyed by event name.
+	// The buckets are keyed by the meter scope of the histogram.
+	events = struct {
+		sync.RWMutex
+		histograms map[string]api.Float64Histogram
+		buckets    map[string][]float64
+	}{
+		histograms: map[string]api.Float64Histogram{},
+		buckets:    map[string][]float64{},
+	}
 )
 
 // MetricsProvider tells prometheus to set up collectors.
@@ -30,7 +75,11 @@ func MetricsProvider(cfg *config.Config) (*metric.MeterProvider, error) {
 		return nil, err
 	}
 
-	provider := metric.NewMeterProvider(metric.WithReader(exporter))
+	provider = metric.NewMeterProvider(
+		metric.WithReader(exporter),
+		metric.WithView(bucketsView),
+	)
+	serviceName = cfg.ServiceName
 	meter := provider.Meter(cfg.ServiceName)
 
 	messagesReceived, _ = meter.Int64Counter("messages_received",
@@ -43,34 +92,115 @@ func MetricsProvider(cfg *config.Config) (*metric.MeterProvider, error) {
 		api.WithUnit("{call}"),
 	)
 
-	timeToProcess, _ = meter.Float64Histogram("task_duration",
-		api.WithDescription("Amount of time spent processing."),
-		api.WithUnit("s"),
+	handlerPanics, _ = meter.Int64Counter("handler_panics",
+		api.WithDescription("Number of panics recovered in event handlers."),
+		api.WithUnit("{call}"),
 	)
 
+	timeToProcess, _ = newTaskDuration(meter)
+
+	if err := registerConsumerInstruments(meter); err != nil {
+		return nil, err
+	}
+
+	if err := registerOutboxInstruments(meter); err != nil {
+		return nil, err
+	}
+
+	if err := registerLeaderInstruments(meter); err != nil {
+		return nil, err
+	}
+
 	otel.SetMeterProvider(provider)
 
 	return provider, nil
 }
 
-// ReceivedMessage records number of messages of each type received.
-func ReceivedMessage(ctx context.Context, msgType string, t int64) {
-	opt := api.WithAttributes(
-		attribute.Key("message_type").String(msgType),
+func newTaskDuration(meter api.Meter) (api.Float64Histogram, error) {
+	return meter.Float64Histogram(taskDuration,
+		api.WithDescription("Amount of time spent processing."),
+		api.WithUnit("s"),
 	)
-	messagesReceived.Add(ctx, t, opt)
+}
+
+// RegisterEvent gives the event its own task_duration histogram with the
+// given bucket boundaries. Nil buckets keep the default boundaries.
+func RegisterEvent(event string, buckets []float64) error {
+	if provider == nil || buckets == nil {
+		return nil
+	}
+
+	scope := serviceName + "/" + event
+
+	// The view reads the buckets when the histogram is created below
+	events.Lock()
+	events.buckets[scope] = buckets
+	events.Unlock()
+
+	histogram, err := newTaskDuration(provider.Meter(scope))
+	if err != nil {
+		return err
+	}
+
+	events.Lock()
+	events.histograms[event] = histogram
+	events.Unlock()
+
+	return nil
+}
+
+// bucketsView applies the bucket boundaries registered for an event to its
+// task_duration histogram.
+func bucketsView(inst metric.Instrument) (metric.Stream, bool) {
+	if inst.Name != taskDuration {
+		return metric.Stream{}, false
+	}
+
+	events.RLock()
+	buckets, ok := events.buckets[inst.Scope.Name]
+	events.RUnlock()
+	if !ok {
+		return metric.Stream{}, false
+	}
+
+	return metric.Stream{
+		Name:        inst.Name,
+		Description: inst.Description,
+		Unit:        inst.Unit,
+		Aggregation: metric.AggregationExplicitBucketHistogram{Boundaries: buckets},
+	}, true
+}
+
+func eventAttributes(event string, attrs ...attribute.KeyValue) api.MeasurementOption {
+	return api.WithAttributes(append(attrs, attribute.Key("event").String(event))...)
+}
+
+// ReceivedMessage records number of messages of each event received.
+func ReceivedMessage(ctx context.Context, event string, t int64) {
+	messagesReceived.Add(ctx, t, eventAttributes(event))
 }
 
 // OccurredError records number of errors occurred while processing messages
-// of each type.
-func OccurredError(ctx context.Context, msgType string) {
-	opt := api.WithAttributes(
-		attribute.Key("not_processed_message_type").String(msgType),
-	)
-	errorsOccurred.Add(ctx, 1, opt)
+// of each event.
+func OccurredError(ctx context.Context, event string) {
+	errorsOccurred.Add(ctx, 1, eventAttributes(event))
+}
+
+// RecoveredPanic records number of panics recovered while handling messages
+// of each event.
+func RecoveredPanic(ctx context.Context, event string) {
+	handlerPanics.Add(ctx, 1, eventAttributes(event))
 }
 
-// ObserveTimeToProcess records amount of time spent processing messages.
-func ObserveTimeToProcess(ctx context.Context, t float64) {
-	timeToProcess.Record(ctx, t)
+// ObserveTimeToProcess records amount of time spent processing a message of
+// the event and how it ended.
+func ObserveTimeToProcess(ctx context.Context, event string, outcome Outcome, t float64) {
+	events.RLock()
+	histogram, ok := events.histograms[event]
+	events.RUnlock()
+	if !ok {
+		histogram = timeToProcess
+	}
+
+	histogram.Record(ctx, t, eventAttributes(event, attribute.Key("outcome").String(string(outcome))))
 }
@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	api "go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+var (
+	outboxRelayLag        api.Float64Histogram = noop.Float64Histogram{}
+	outboxPublishFailures api.Int64Counter     = noop.Int64Counter{}
+
+	outboxPending = struct {
+		sync.Mutex
+		observed bool
+		oldest   time.Time
+	}{}
+)
+
+// registerOutboxInstruments sets up the metrics of the outbox relay.
+func registerOutboxInstruments(meter api.Meter) error {
+	var err error
+
+	outboxRelayLag, err = meter.Float64Histogram("outbox_relay_lag",
+		api.WithDescription("Time between a message entering the outbox and being published."),
+		api.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	outboxPublishFailures, err = meter.Int64Counter("outbox_publish_failures",
+		api.WithDescription("Number of outbox messages that failed to publish."),
+		api.WithUnit("{message}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	oldestPendingAge, err := meter.Float64ObservableGauge("outbox_oldest_pending_age",
+		api.WithDescription("Time since the oldest outbox message not yet published, parked ones included, entered the outbox."),
+		api.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o api.Observer) error {
+		outboxPending.Lock()
+		defer outboxPending.Unlock()
+
+		if !outboxPending.observed {
+			return nil
+		}
+
+		var age float64
+		if !outboxPending.oldest.IsZero() {
+			age = time.Since(outboxPending.oldest).Seconds()
+		}
+		o.ObserveFloat64(oldestPendingAge, age)
+
+		return nil
+	}, oldestPendingAge)
+
+	return err
+}
+
+// SetOutboxOldestPending stores when the oldest outbox message not yet
+// published entered the outbox, the zero time meaning there is none. Its
+// age is reported on the next collection.
+func SetOutboxOldestPending(oldest time.Time) {
+	outboxPending.Lock()
+	defer outboxPending.Unlock()
+
+	outboxPending.observed = true
+	outboxPending.oldest = oldest
+}
+
+// OutboxRelayed records that an outbox message was published t seconds
+// after entering the outbox.
+func OutboxRelayed(ctx context.Context, t float64) {
+	outboxRelayLag.Record(ctx, t)
+}
+
+// OutboxPublishFailed records that an outbox message failed to publish.
+func OutboxPublishFailed(ctx context.Context) {
+	outboxPublishFailures.Add(ctx, 1)
+}
@@ -0,0 +1,256 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"template-subscriber-go/example"
+	"template-subscriber-go/monitoring/metrics"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+// AppEvents contains a slice of AppEvent.
+type AppEvents []AppEvent
+
+// OverlapPolicy tells what happens when a run of an AppEvent is due while
+// the previous one is still going.
+type OverlapPolicy string
+
+const (
+	// OverlapSkip drops the run.
+	OverlapSkip OverlapPolicy = "skip"
+	// OverlapQueue starts the run once the previous one returned. At most
+	// one run waits at a time, further ones are dropped.
+	OverlapQueue OverlapPolicy = "queue"
+	// OverlapAllow starts the run right away, alongside the previous one.
+	OverlapAllow OverlapPolicy = "allow"
+)
+
+// AppEvent contains the data for an in-app event type.
+type AppEvent struct {
+	Name string
+	// Rate runs the handler at a fixed rate.
+	Rate time.Duration
+	// Cron runs the handler on a cron schedule instead of Rate, in the
+	// standard five fields format or a descriptor such as "@hourly".
+	Cron    string
+	Handler Handler
+	// Timeout is the deadline of the context passed to the handler on each
+	// run. Zero means no deadline.
+	Timeout time.Duration
+	// Overlap is what happens when a run is due while the previous one is
+	// still going. Defaults to OverlapSkip.
+	Overlap OverlapPolicy
+	// Jitter delays each run by a random duration up to Jitter, so the
+	// replicas of a service do not all run at the same instant.
+	Jitter time.Duration
+	// RunOnStart runs the handler as soon as the event starts, then on
+	// schedule.
+	RunOnStart bool
+	// Leader, when set, elects a single replica to run the event. On every
+	// due run the replicas try to become the leader, and only the leader
+	// runs the handler.
+	Leader Elector
+
+	isLeader atomic.Bool
+	stop     context.CancelFunc // stops scheduling new runs
+	abort    context.CancelFunc // cancels the runs still going
+	done     chan struct{}      // closed once every run has returned
+}
+
+// SubscribeAndListen starts running an AppEvent on its schedule until ctx is
+// done or the event is shut down.
+func (e *AppEvent) SubscribeAndListen(ctx context.Context, errc chan<- error) {
+	if e.Overlap == "" {
+		e.Overlap = OverlapSkip
+	}
+
+	schedule, err := e.schedule()
+	if err != nil {
+		errc <- fmt.Errorf("app event %s: %w", e.Name, err)
+		return
+	}
+
+	scheduleCtx, stop := context.WithCancel(ctx)
+	runCtx, abort := context.WithCancel(ctx)
+	e.stop, e.abort = stop, abort
+	e.done = make(chan struct{})
+
+	go e.listen(scheduleCtx, runCtx, schedule)
+}
+
+// Shutdown stops scheduling new runs and waits for the current ones to
+// return. When ctx is done before that, the runs are cancelled. The
+// leadership of the event is then released.
+func (e *AppEvent) Shutdown(ctx context.Context) {
+	if e.stop == nil {
+		return
+	}
+
+	e.stop()
+
+	select {
+	case <-e.done:
+	case <-ctx.Done():
+		log.Warnf("%s: shutdown deadline exceeded, cancelling running handler", e.Name)
+		e.abort()
+		<-e.done
+	}
+
+	e.abort()
+	e.stepDown(ctx)
+}
+
+// schedule returns when the event runs.
+func (e *AppEvent) schedule() (cron.Schedule, error) {
+	switch e.Overlap {
+	case OverlapSkip, OverlapQueue, OverlapAllow:
+	default:
+		return nil, fmt.Errorf("unknown overlap policy %q", e.Overlap)
+	}
+
+	if e.Cron != "" {
+		schedule, err := cron.ParseStandard(e.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("parse cron %q: %w", e.Cron, err)
+		}
+		return schedule, nil
+	}
+
+	if e.Rate <= 0 {
+		return nil, errors.New("either Rate or Cron is required")
+	}
+
+	return rateSchedule(e.Rate), nil
+}
+
+// rateSchedule runs at a fixed rate.
+type rateSchedule time.Duration
+
+// Next returns the next run after t.
+func (r rateSchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(r))
+}
+
+// listen triggers the runs on schedule until scheduleCtx is done, then waits
+// for the runs still going.
+func (e *AppEvent) listen(scheduleCtx, runCtx context.Context, schedule cron.Schedule) {
+	defer close(e.done)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	// A single runner takes the due runs, so they never overlap. Pending
+	// counts the runs queued or going: with OverlapQueue one run may wait
+	// for the current one, with OverlapSkip none.
+	var due chan time.Time
+	var mu sync.Mutex
+	pending, limit := 0, 1
+	if e.Overlap != OverlapAllow {
+		if e.Overlap == OverlapQueue {
+			limit = 2
+		}
+		due = make(chan time.Time, limit)
+		defer close(due)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range due {
+				e.run(runCtx, t)
+
+				mu.Lock()
+				pending--
+				mu.Unlock()
+			}
+		}()
+	}
+
+	trigger := func(t time.Time) {
+		if e.Overlap == OverlapAllow {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				e.run(runCtx, t)
+			}()
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if pending >= limit {
+			log.Warnf("%s: previous run still going, skipping run due at %s", e.Name, t.Format(time.RFC3339))
+			return
+		}
+
+		// Never blocks, the channel has room for every pending run
+		pending++
+		due <- t
+	}
+
+	if e.RunOnStart {
+		trigger(time.Now())
+	}
+
+	next := schedule.Next(time.Now())
+	for {
+		timer := time.NewTimer(time.Until(next) + e.jitter())
+
+		select {
+		case <-scheduleCtx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			trigger(next)
+		}
+
+		// Skip the runs missed while the process was not scheduled
+		now := time.Now()
+		next = schedule.Next(next)
+		if next.Before(now) {
+			next = schedule.Next(now)
+		}
+	}
+}
+
+// jitter returns a random delay up to Jitter.
+func (e *AppEvent) jitter() time.Duration {
+	if e.Jitter <= 0 {
+		return 0
+	}
+
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+
+	return time.Duration(jitterRand.Int63n(int64(e.Jitter)))
+}
+
+// run calls the handler once for the run due at t.
+func (e *AppEvent) run(ctx context.Context, t time.Time) {
+	var errExpected example.ErrExpected
+	var errPanic PanicError
+
+	if !e.lead(ctx) {
+		return
+	}
+
+	if e.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.Timeout)
+		defer cancel()
+	}
+
+	err := safeHandle(ctx, e.Handler, nil)
+	if errors.As(err, &errPanic) {
+		metrics.RecoveredPanic(ctx, e.Name)
+	}
+	if err != nil && !errors.As(err, &errExpected) {
+		log.Errorf("%s: run due at %s: %v", e.Name, t.Format(time.RFC3339), err)
+	}
+}
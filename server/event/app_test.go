@@ -0,0 +1,105 @@
+package event
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAppEventRunOnStart(t *testing.T) {
+	for _, overlap := range []OverlapPolicy{OverlapSkip, OverlapQueue, OverlapAllow} {
+		t.Run(string(overlap), func(t *testing.T) {
+			for i := 0; i < 50; i++ {
+				ran := make(chan struct{}, 1)
+				e := AppEvent{
+					Name:       "RunOnStart",
+					Rate:       time.Hour,
+					Overlap:    overlap,
+					RunOnStart: true,
+					Handler: HandlerFunc(func(context.Context, []byte) error {
+						ran <- struct{}{}
+						return nil
+					}),
+				}
+
+				errc := make(chan error, 1)
+				e.SubscribeAndListen(context.Background(), errc)
+
+				select {
+				case <-ran:
+				case err := <-errc:
+					t.Fatal(err)
+				case <-time.After(time.Second):
+					t.Fatalf("attempt %d: no run on start", i)
+				}
+
+				e.Shutdown(context.Background())
+			}
+		})
+	}
+}
+
+func TestAppEventOverlapSkip(t *testing.T) {
+	var runs atomic.Int32
+	release := make(chan struct{})
+	e := AppEvent{
+		Name:       "OverlapSkip",
+		Rate:       10 * time.Millisecond,
+		RunOnStart: true,
+		Handler: HandlerFunc(func(context.Context, []byte) error {
+			runs.Add(1)
+			<-release
+			return nil
+		}),
+	}
+
+	errc := make(chan error, 1)
+	e.SubscribeAndListen(context.Background(), errc)
+	defer func() {
+		close(release)
+		e.Shutdown(context.Background())
+	}()
+
+	// Several runs are due while the first one is still going
+	time.Sleep(100 * time.Millisecond)
+	if got := runs.Load(); got != 1 {
+		t.Errorf("got %d runs while the first one is going, want 1", got)
+	}
+}
+
+func TestAppEventOverlapQueue(t *testing.T) {
+	var runs atomic.Int32
+	release := make(chan struct{})
+	e := AppEvent{
+		Name:       "OverlapQueue",
+		Rate:       10 * time.Millisecond,
+		Overlap:    OverlapQueue,
+		RunOnStart: true,
+		Handler: HandlerFunc(func(context.Context, []byte) error {
+			runs.Add(1)
+			<-release
+			return nil
+		}),
+	}
+
+	errc := make(chan error, 1)
+	e.SubscribeAndListen(context.Background(), errc)
+	defer func() {
+		close(release)
+		e.Shutdown(context.Background())
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	if got := runs.Load(); got != 1 {
+		t.Fatalf("got %d runs while the first one is going, want 1", got)
+	}
+
+	// One of the runs due meanwhile was queued and starts right away, the
+	// others were skipped
+	release <- struct{}{}
+	time.Sleep(100 * time.Millisecond)
+	if got := runs.Load(); got != 2 {
+		t.Errorf("got %d runs once the first one returned, want 2", got)
+	}
+}
@@ -0,0 +1,133 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"template-subscriber-go/client/pubsub"
+	"template-subscriber-go/monitoring/metrics"
+	"time"
+
+	"go.opentelemetry.io/otel"
+)
+
+// BatchHandler is an interface for handlers processing several messages at
+// once, such as writing them with a single multi-row insert.
+//
+// HandleBatch returns one error per message, in the order of msgs, nil for
+// the messages handled successfully. Each message is then acked or retried
+// according to its own error.
+//
+// Middlewares wrap a single message handler, so neither the global ones of
+// the Registry nor the ones of the event apply to a BatchHandler. The batch
+// is traced, measured and its errors logged like the default middlewares do,
+// and an event setting both Middlewares and a BatchHandler fails to start.
+type BatchHandler interface {
+	HandleBatch(ctx context.Context, msgs []pubsub.Message) []error
+}
+
+// collect waits for a message and then gathers more until the batch holds
+// BatchSize messages or BatchLinger passed. It returns false once the
+// queue is closed.
+func (e *PubSubEvent) collect(queue <-chan pubsub.Message) ([]pubsub.Message, bool) {
+	msg, ok := <-queue
+	if !ok {
+		return nil, false
+	}
+
+	batch := []pubsub.Message{msg}
+	timer := time.NewTimer(e.BatchLinger)
+	defer timer.Stop()
+
+	for len(batch) < e.BatchSize {
+		select {
+		case msg, ok := <-queue:
+			if !ok {
+				return batch, false
+			}
+			batch = append(batch, msg)
+		case <-timer.C:
+			return batch, true
+		}
+	}
+
+	return batch, true
+}
+
+// deadLetterExceeded moves the messages delivered more than MaxDeliver
+// times to the dead letter subject and returns the others.
+func (e *PubSubEvent) deadLetterExceeded(batch []pubsub.Message) []pubsub.Message {
+	kept := batch[:0]
+	for _, msg := range batch {
+		if e.exceeded(msg) {
+			e.deadLetter(msg, errMaxDeliver)
+			continue
+		}
+		kept = append(kept, msg)
+	}
+
+	return kept
+}
+
+// handleBatch passes the batch to the BatchHandler and settles every
+// message according to its error.
+func (e *PubSubEvent) handleBatch(ctx context.Context, batch []pubsub.Message) {
+	ctx = withEventName(ctx, e.Name)
+	ctx, span := otel.Tracer(e.Name).Start(ctx, e.Name+" batch")
+	defer span.End()
+
+	size := int64(len(batch))
+	metrics.ReceivedMessage(ctx, e.Name, size)
+	metrics.HandlerStarted(ctx, e.Name, size)
+	defer metrics.HandlerFinished(ctx, e.Name, size)
+	start := time.Now()
+
+	handleCtx, cancel := context.WithTimeout(ctx, e.Timeout)
+	stops := make([]func(), len(batch))
+	for i, msg := range batch {
+		stops[i] = e.inProgress(msg)
+	}
+	errs := safeHandleBatch(handleCtx, e.BatchHandler, batch)
+	timedOut := errors.Is(handleCtx.Err(), context.DeadlineExceeded)
+	for _, stop := range stops {
+		stop()
+	}
+	cancel()
+
+	duration := time.Since(start)
+	for i, msg := range batch {
+		if errs[i] != nil && aborted(ctx) {
+			_ = msg.Nak()
+			metrics.ObserveTimeToProcess(ctx, e.Name, metrics.OutcomeNak, duration.Seconds())
+			continue
+		}
+		recordError(ctx, e.Name, errs[i])
+		outcome := e.settle(msg, errs[i], timedOut)
+		metrics.ObserveTimeToProcess(ctx, e.Name, outcome, duration.Seconds())
+	}
+}
+
+// safeHandleBatch calls the batch handler and makes sure there is one error
+// per message. A panic fails the whole batch with a PanicError.
+func safeHandleBatch(ctx context.Context, h BatchHandler, msgs []pubsub.Message) (errs []error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err := newPanicError(r)
+			errs = make([]error, len(msgs))
+			for i := range errs {
+				errs[i] = err
+			}
+		}
+	}()
+
+	errs = h.HandleBatch(ctx, msgs)
+	if len(errs) != len(msgs) {
+		err := fmt.Errorf("batch handler returned %d errors for %d messages", len(errs), len(msgs))
+		errs = make([]error, len(msgs))
+		for i := range errs {
+			errs[i] = err
+		}
+	}
+
+	return errs
+}
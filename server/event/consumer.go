@@ -0,0 +1,48 @@
+package event
+
+import (
+	"template-subscriber-go/client/pubsub"
+
+	"github.com/nats-io/nats.go"
+)
+
+// consumerConfig builds the config of the durable consumer of the event.
+func (e *PubSubEvent) consumerConfig() *nats.ConsumerConfig {
+	// MaxDeliver is left unlimited because the receiver dead letters
+	// messages itself, so the server keeps redelivering the ones whose last
+	// attempt could not be settled. The server requires a limit above the
+	// number of backoff delays though, so with a BackOff it gets one more
+	// delivery than the receiver to dead letter those messages.
+	maxDeliver := -1
+	if len(e.BackOff) > 0 {
+		maxDeliver = e.MaxDeliver + 1
+	}
+
+	cfg := &nats.ConsumerConfig{
+		Durable:           e.SubscriptionName,
+		AckPolicy:         nats.AckExplicitPolicy,
+		DeliverPolicy:     e.DeliverPolicy,
+		AckWait:           e.AckWait,
+		MaxDeliver:        maxDeliver,
+		MaxAckPending:     e.MaxAckPending,
+		BackOff:           e.BackOff,
+		ReplayPolicy:      e.ReplayPolicy,
+		InactiveThreshold: e.InactiveThreshold,
+	}
+
+	switch e.DeliverPolicy {
+	case nats.DeliverByStartTimePolicy:
+		startTime := e.StartTime
+		cfg.OptStartTime = &startTime
+	case nats.DeliverByStartSequencePolicy:
+		cfg.OptStartSeq = e.StartSequence
+	}
+
+	filters := e.FilterSubjects
+	if len(filters) == 0 {
+		filters = []string{e.Queue}
+	}
+	pubsub.SetFilterSubjects(cfg, filters)
+
+	return cfg
+}
@@ -0,0 +1,58 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"template-subscriber-go/client/pubsub"
+	"template-subscriber-go/monitoring/metrics"
+
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+)
+
+// Headers added to messages published to a dead letter subject. The
+// original headers of the message are kept.
+const (
+	HeaderDeadLetterReason     = "Dead-Letter-Reason"
+	HeaderDeadLetterEvent      = "Dead-Letter-Event"
+	HeaderDeadLetterSubject    = "Dead-Letter-Subject"
+	HeaderDeadLetterStream     = "Dead-Letter-Stream"
+	HeaderDeadLetterSequence   = "Dead-Letter-Stream-Sequence"
+	HeaderDeadLetterDeliveries = "Dead-Letter-Deliveries"
+)
+
+// deadLetter publishes the message to the dead letter subject and
+// terminates the original so it is not redelivered again. When publishing
+// fails the message is left to the server, which redelivers it, and it is
+// dead lettered again on that delivery without being handled.
+func (e *PubSubEvent) deadLetter(msg pubsub.Message, cause error) metrics.Outcome {
+	dlq := pubsub.Message{
+		Subject: e.DeadLetterSubject,
+		Data:    msg.Data,
+		Header:  nats.Header{},
+	}
+	for key, values := range msg.Header {
+		dlq.Header[key] = append([]string(nil), values...)
+	}
+
+	dlq.Header.Set(HeaderDeadLetterReason, cause.Error())
+	dlq.Header.Set(HeaderDeadLetterEvent, e.Name)
+	dlq.Header.Set(HeaderDeadLetterSubject, msg.Subject)
+	dlq.Header.Set(HeaderDeadLetterStream, msg.Stream)
+	dlq.Header.Set(HeaderDeadLetterSequence, strconv.FormatUint(msg.StreamSequence, 10))
+	dlq.Header.Set(HeaderDeadLetterDeliveries, strconv.FormatUint(msg.NumDelivered, 10))
+
+	// The id makes publishing the same message twice idempotent
+	dlq.Header.Set(nats.MsgIdHdr, fmt.Sprintf("%s-%s-%d", e.Name, msg.Stream, msg.StreamSequence))
+
+	if _, err := e.Broker.Publish(context.Background(), dlq); err != nil {
+		log.Errorf("%s: publish stream sequence %d to dead letter subject %s: %v",
+			e.Name, msg.StreamSequence, e.DeadLetterSubject, err)
+		e.retry(msg)
+		return metrics.OutcomeNak
+	}
+
+	_ = msg.Term()
+	return metrics.OutcomeTerm
+}
@@ -0,0 +1,42 @@
+// Package event handles configuration and setup for receiving events.
+//
+// Events to subscribe to are registered on a Registry, usually the one of
+// the server.
+package event
+
+import (
+	"context"
+	"template-subscriber-go/client/pubsub"
+)
+
+// Handler is an interface that all event handles must implement.
+type Handler interface {
+	Handle(ctx context.Context, data []byte) error
+}
+
+// MessageHandler is implemented by handlers that need the headers and
+// delivery metadata of the message, not only its payload.
+type MessageHandler interface {
+	HandleMessage(ctx context.Context, msg pubsub.Message) error
+}
+
+// FromMessageHandler adapts a MessageHandler so it can be used wherever a
+// Handler is expected.
+func FromMessageHandler(h MessageHandler) Handler {
+	return messageHandler{h}
+}
+
+type messageHandler struct {
+	MessageHandler
+}
+
+// Handle passes the message being handled to the MessageHandler. Outside of
+// a pubsub event, such as in an app event, the message only holds data.
+func (h messageHandler) Handle(ctx context.Context, data []byte) error {
+	msg, ok := pubsub.MessageFromContext(ctx)
+	if !ok {
+		msg = pubsub.Message{Data: data}
+	}
+
+	return h.HandleMessage(ctx, msg)
+}
@@ -0,0 +1,66 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"template-subscriber-go/client/database"
+	"template-subscriber-go/client/pubsub"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DedupStore records which messages were processed for each event.
+type DedupStore interface {
+	IsProcessed(ctx context.Context, event, key string) (bool, error)
+	MarkProcessed(ctx context.Context, event, key string) error
+}
+
+// Idempotent skips, and so acks, the messages already processed for the
+// event, and marks the others processed once the handler succeeds. The key
+// of a message is taken from key, or from Message.ID when key is nil. The
+// database.Client store needs a server set up with server.WithDedup.
+//
+// Handlers whose writes must be committed together with the dedup record
+// can use database.Client.WithDedup with the same key. The
+// database.ErrAlreadyProcessed it returns is treated as a success.
+func Idempotent(store DedupStore, key func(pubsub.Message) string) Middleware {
+	if key == nil {
+		key = pubsub.Message.ID
+	}
+
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, data []byte) error {
+			msg, ok := pubsub.MessageFromContext(ctx)
+			if !ok {
+				return next.Handle(ctx, data)
+			}
+
+			name, id := EventName(ctx), key(msg)
+
+			processed, err := store.IsProcessed(ctx, name, id)
+			if err != nil {
+				return fmt.Errorf("idempotency check: %w", err)
+			}
+			if processed {
+				log.Debugf("%s: skipping already processed message %s", name, id)
+				return nil
+			}
+
+			err = next.Handle(ctx, data)
+			if errors.Is(err, database.ErrAlreadyProcessed) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			// The work is done, so a failure here must not trigger a retry
+			if err := store.MarkProcessed(ctx, name, id); err != nil {
+				log.Errorf("%s: mark message %s processed: %v", name, id, err)
+			}
+
+			return nil
+		})
+	}
+}
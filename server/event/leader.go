@@ -0,0 +1,57 @@
+package event
+
+import (
+	"context"
+	"template-subscriber-go/monitoring/metrics"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Elector elects the single replica running an AppEvent.
+type Elector interface {
+	// TryAcquire reports whether this replica is the leader, becoming it
+	// if there is none.
+	TryAcquire(ctx context.Context) (bool, error)
+	// Release steps down if this replica is the leader.
+	Release(ctx context.Context) error
+}
+
+// IsLeader reports whether this replica is the leader of the event. It is
+// always false for events without a Leader.
+func (e *AppEvent) IsLeader() bool {
+	return e.isLeader.Load()
+}
+
+// lead reports whether this replica should run the event, trying to become
+// its leader when the event has one.
+func (e *AppEvent) lead(ctx context.Context) bool {
+	if e.Leader == nil {
+		return true
+	}
+
+	isLeader, err := e.Leader.TryAcquire(ctx)
+	if err != nil {
+		log.Errorf("%s: elect leader: %v", e.Name, err)
+	}
+
+	if e.isLeader.Swap(isLeader) != isLeader && isLeader {
+		log.Infof("%s: became leader", e.Name)
+	}
+	metrics.SetLeader(e.Name, isLeader)
+
+	return isLeader
+}
+
+// stepDown releases the leadership of the event, if held.
+func (e *AppEvent) stepDown(ctx context.Context) {
+	if e.Leader == nil {
+		return
+	}
+
+	if err := e.Leader.Release(ctx); err != nil {
+		log.Errorf("%s: release leadership: %v", e.Name, err)
+	}
+
+	e.isLeader.Store(false)
+	metrics.SetLeader(e.Name, false)
+}
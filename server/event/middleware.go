@@ -0,0 +1,137 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"template-subscriber-go/client/pubsub"
+	"template-subscriber-go/example"
+	"template-subscriber-go/monitoring/metrics"
+	"template-subscriber-go/monitoring/trace"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// Middleware wraps a Handler to run code around it, such as validation,
+// auth checks or auditing.
+type Middleware func(Handler) Handler
+
+// HandlerFunc lets an ordinary function be used as a Handler.
+type HandlerFunc func(ctx context.Context, data []byte) error
+
+// Handle calls f(ctx, data).
+func (f HandlerFunc) Handle(ctx context.Context, data []byte) error {
+	return f(ctx, data)
+}
+
+// Chain wraps h in the middlewares. The first middleware is the outermost,
+// so it runs first.
+func Chain(h Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// DefaultMiddlewares trace, measure and log the handling of every message,
+// and recover panics so the other middlewares see them as errors.
+func DefaultMiddlewares() []Middleware {
+	return []Middleware{
+		Tracing(),
+		Metrics(),
+		Errors(),
+		Recover(),
+	}
+}
+
+// Tracing continues the trace found in the headers of the message and runs
+// the handler in a span named after the event.
+func Tracing() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, data []byte) error {
+			name := EventName(ctx)
+			if msg, ok := pubsub.MessageFromContext(ctx); ok {
+				ctx = trace.ExtractFromCarrier(ctx, propagation.HeaderCarrier(msg.Header), name)
+			}
+
+			ctx, span := otel.Tracer(name).Start(ctx, name)
+			defer span.End()
+
+			return next.Handle(ctx, data)
+		})
+	}
+}
+
+// Metrics counts the messages received and the handlers in flight.
+func Metrics() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, data []byte) error {
+			name := EventName(ctx)
+
+			metrics.ReceivedMessage(ctx, name, 1)
+			metrics.HandlerStarted(ctx, name, 1)
+			defer metrics.HandlerFinished(ctx, name, 1)
+
+			return next.Handle(ctx, data)
+		})
+	}
+}
+
+// Errors logs the errors that are not expected and records them on the span
+// and in the metrics.
+func Errors() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, data []byte) error {
+			err := next.Handle(ctx, data)
+			recordError(ctx, EventName(ctx), err)
+
+			return err
+		})
+	}
+}
+
+// recordError logs err unless it is expected, and records it on the span
+// and in the metrics.
+func recordError(ctx context.Context, name string, err error) {
+	var errExpected example.ErrExpected
+	if err == nil || errors.As(err, &errExpected) || aborted(ctx) {
+		return
+	}
+
+	log.Error(err.Error())
+	span := oteltrace.SpanFromContext(ctx)
+	span.SetStatus(codes.Error, "handle event failed")
+	span.RecordError(err)
+	metrics.OccurredError(ctx, name)
+
+	var errPanic PanicError
+	if errors.As(err, &errPanic) {
+		metrics.RecoveredPanic(ctx, name)
+	}
+}
+
+// Recover converts a panic in the handler into a PanicError.
+func Recover() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, data []byte) error {
+			return safeHandle(ctx, next, data)
+		})
+	}
+}
+
+type eventNameKey struct{}
+
+// withEventName returns a copy of ctx carrying the name of the event being
+// handled.
+func withEventName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, eventNameKey{}, name)
+}
+
+// EventName returns the name of the event being handled.
+func EventName(ctx context.Context) string {
+	name, _ := ctx.Value(eventNameKey{}).(string)
+	return name
+}
@@ -0,0 +1,45 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicPolicy decides what happens to a message whose handler panicked.
+type PanicPolicy string
+
+const (
+	// PanicPolicyNak treats the panic like a recoverable error, so the
+	// message is retried according to the RetryPolicy and MaxDeliver.
+	PanicPolicyNak PanicPolicy = "nak"
+	// PanicPolicyTerm treats the panic as non-recoverable and terminates the
+	// message.
+	PanicPolicyTerm PanicPolicy = "term"
+)
+
+// PanicError is returned in place of a panic raised by a handler.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e PanicError) Error() string {
+	return fmt.Sprintf("handler panicked: %v\n%s", e.Value, e.Stack)
+}
+
+// safeHandle calls the handler and converts a panic into a PanicError.
+func safeHandle(ctx context.Context, h Handler, data []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = newPanicError(r)
+		}
+	}()
+
+	return h.Handle(ctx, data)
+}
+
+// newPanicError captures the stack of the goroutine recovering from r.
+func newPanicError(r interface{}) PanicError {
+	return PanicError{Value: r, Stack: debug.Stack()}
+}
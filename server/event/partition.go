@@ -0,0 +1,106 @@
+package event
+
+import (
+	"hash/fnv"
+	"strings"
+	"template-subscriber-go/client/pubsub"
+)
+
+// HeaderPartitionKey returns a PartitionKey reading the key from a header
+// of the message.
+func HeaderPartitionKey(header string) func(pubsub.Message) string {
+	return func(msg pubsub.Message) string {
+		return msg.Header.Get(header)
+	}
+}
+
+// SubjectTokenPartitionKey returns a PartitionKey reading the key from the
+// token at index of the dot separated subject, such as 1 for the id in
+// "orders.<id>.created".
+func SubjectTokenPartitionKey(index int) func(pubsub.Message) string {
+	return func(msg pubsub.Message) string {
+		tokens := strings.Split(msg.Subject, ".")
+		if index < 0 || index >= len(tokens) {
+			return ""
+		}
+		return tokens[index]
+	}
+}
+
+// partitioner routes fetched messages to the worker queues. Without a
+// PartitionKey all workers share a single queue. With one, every worker has
+// its own queue and messages with the same key always go to the same
+// worker, which keeps their order.
+type partitioner struct {
+	key    func(pubsub.Message) string
+	queues []chan pubsub.Message
+	next   int
+}
+
+func newPartitioner(key func(pubsub.Message) string, workers, queueSize int) *partitioner {
+	p := &partitioner{key: key}
+
+	if key == nil {
+		p.queues = []chan pubsub.Message{make(chan pubsub.Message, queueSize)}
+		return p
+	}
+
+	p.queues = make([]chan pubsub.Message, workers)
+	for i := range p.queues {
+		p.queues[i] = make(chan pubsub.Message, queueSize)
+	}
+	return p
+}
+
+// queue returns the queue read by the given worker.
+func (p *partitioner) queue(worker int) chan pubsub.Message {
+	return p.queues[worker%len(p.queues)]
+}
+
+// dispatch sends the message to the queue of its partition. Messages
+// without a key are spread over the queues in turn.
+func (p *partitioner) dispatch(msg pubsub.Message) {
+	if len(p.queues) == 1 {
+		p.queues[0] <- msg
+		return
+	}
+
+	key := p.key(msg)
+	if key == "" {
+		p.next = (p.next + 1) % len(p.queues)
+		p.queues[p.next] <- msg
+		return
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	p.queues[jumpHash(h.Sum64(), len(p.queues))] <- msg
+}
+
+// size returns the number of messages waiting in all the queues.
+func (p *partitioner) size() int {
+	n := 0
+	for _, queue := range p.queues {
+		n += len(queue)
+	}
+	return n
+}
+
+// close closes all the queues so the workers return once they drained them.
+func (p *partitioner) close() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+}
+
+// jumpHash is the jump consistent hash of Lamping and Veach. It maps key to
+// one of n buckets, moving as few keys as possible when n changes.
+func jumpHash(key uint64, n int) int {
+	var b, j int64 = -1, 0
+	for j < int64(n) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
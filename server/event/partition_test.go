@@ -0,0 +1,171 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+	"template-subscriber-go/client/pubsub"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestJumpHash(t *testing.T) {
+	// Reference outputs of the implementation in the paper
+	tests := []struct {
+		key  uint64
+		n    int
+		want int
+	}{
+		{1, 1, 0},
+		{42, 57, 43},
+		{0xDEAD10CC, 1, 0},
+		{0xDEAD10CC, 666, 361},
+		{256, 1024, 520},
+	}
+	for _, tt := range tests {
+		if got := jumpHash(tt.key, tt.n); got != tt.want {
+			t.Errorf("jumpHash(%#x, %d) = %d, want %d", tt.key, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestJumpHashMovesKeysToNewBucketsOnly(t *testing.T) {
+	for key := uint64(0); key < 1000; key++ {
+		previous := jumpHash(key, 1)
+		for n := 2; n <= 32; n++ {
+			got := jumpHash(key, n)
+			if got != previous && got != n-1 {
+				t.Fatalf("key %d moved from bucket %d to %d going to %d buckets", key, previous, got, n)
+			}
+			previous = got
+		}
+	}
+}
+
+func TestPartitionKeys(t *testing.T) {
+	msg := pubsub.Message{
+		Subject: "orders.42.created",
+		Header:  nats.Header{"Tenant": []string{"acme"}},
+	}
+
+	if got := HeaderPartitionKey("Tenant")(msg); got != "acme" {
+		t.Errorf("got header key %q, want acme", got)
+	}
+	if got := SubjectTokenPartitionKey(1)(msg); got != "42" {
+		t.Errorf("got subject key %q, want 42", got)
+	}
+	if got := SubjectTokenPartitionKey(3)(msg); got != "" {
+		t.Errorf("got subject key %q past the last token, want none", got)
+	}
+}
+
+// bucket returns the worker the partitioner hands the messages of key to.
+func bucket(key string, workers int) int {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return jumpHash(h.Sum64(), workers)
+}
+
+func TestPubSubEventPartitionKey(t *testing.T) {
+	const workers, perKey = 4, 20
+
+	// Keys landing on different workers, so they are handled concurrently
+	var keys []string
+	used := map[int]bool{}
+	for i := 0; len(keys) < 3; i++ {
+		key := fmt.Sprint("key", i)
+		if b := bucket(key, workers); !used[b] {
+			used[b] = true
+			keys = append(keys, key)
+		}
+	}
+
+	var mu sync.Mutex
+	inFlight := map[string]int{}
+	handled := map[string][]int{}
+	var overlaps []string
+
+	// The first message of every key waits for the first one of the others
+	var started sync.WaitGroup
+	started.Add(len(keys))
+	allStarted := make(chan struct{})
+	go func() {
+		started.Wait()
+		close(allStarted)
+	}()
+
+	broker := pubsub.NewMemoryBroker()
+	e := &PubSubEvent{
+		Name:             "Partition",
+		Queue:            "orders.>",
+		SubscriptionName: "partition",
+		Workers:          workers,
+		Timeout:          10 * time.Second,
+		AckWait:          time.Minute,
+		PartitionKey:     SubjectTokenPartitionKey(1),
+		Handler: HandlerFunc(func(ctx context.Context, data []byte) error {
+			key, seq, _ := strings.Cut(string(data), ":")
+			n, _ := strconv.Atoi(seq)
+
+			mu.Lock()
+			inFlight[key]++
+			if inFlight[key] > 1 {
+				overlaps = append(overlaps, string(data))
+			}
+			mu.Unlock()
+
+			if n == 0 {
+				started.Done()
+				select {
+				case <-allStarted:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			time.Sleep(time.Millisecond)
+
+			mu.Lock()
+			inFlight[key]--
+			handled[key] = append(handled[key], n)
+			mu.Unlock()
+
+			return nil
+		}),
+	}
+	listen(t, e, broker)
+
+	for i := 0; i < perKey; i++ {
+		for _, key := range keys {
+			msg := pubsub.Message{
+				Subject: "orders." + key,
+				Data:    []byte(fmt.Sprintf("%s:%d", key, i)),
+			}
+			if _, err := broker.Publish(context.Background(), msg); err != nil {
+				t.Fatalf("publish: %v", err)
+			}
+		}
+	}
+
+	eventually(t, "every message to be acked", func() bool {
+		return broker.Settlements("partition").Acked == perKey*len(keys)
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(overlaps) > 0 {
+		t.Errorf("messages handled while another one of their key was: %v", overlaps)
+	}
+	for _, key := range keys {
+		for i, n := range handled[key] {
+			if n != i {
+				t.Fatalf("key %s handled in order %v", key, handled[key])
+			}
+		}
+	}
+}
@@ -0,0 +1,511 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"template-subscriber-go/client/pubsub"
+	"template-subscriber-go/config"
+	"template-subscriber-go/example"
+	"template-subscriber-go/monitoring/metrics"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+)
+
+// PubSubEvents contains a slice of PubSubEvent.
+type PubSubEvents []PubSubEvent
+
+// PubSubEvent contains the data for a PubSub event type.
+//
+// Workers, QueueSize, FetchBatch and FetchMaxWait tune the receiver. When
+// left at zero they are taken from the config.
+type PubSubEvent struct {
+	Name             string
+	Queue            string
+	SubscriptionName string
+	Handler          Handler
+	Broker           pubsub.Broker
+	// Middlewares wrap the handler of this event only, inside the global
+	// middlewares of the Registry it is registered on.
+	Middlewares []Middleware
+
+	// BatchHandler, when set, is used instead of Handler and receives up to
+	// BatchSize messages at once, waiting at most BatchLinger for a batch
+	// to fill up. They default to FetchBatch and FetchMaxWait. Middlewares
+	// do not wrap it.
+	BatchHandler BatchHandler
+	BatchSize    int
+	BatchLinger  time.Duration
+
+	// Workers is the number of goroutines handling messages concurrently.
+	Workers int
+	// QueueSize is the number of fetched messages waiting for a free worker,
+	// per worker when PartitionKey is set.
+	QueueSize int
+	// PartitionKey, when set, routes all messages with the same key to the
+	// same worker, so they are handled one at a time and in order, while
+	// messages with different keys are still handled in parallel.
+	PartitionKey func(pubsub.Message) string
+	// FetchBatch is the maximum number of messages pulled per fetch.
+	FetchBatch int
+	// FetchMaxWait is how long a fetch waits for messages before polling again.
+	FetchMaxWait time.Duration
+
+	// RetryPolicy delays the redelivery of messages that failed with a
+	// recoverable error. When nil they are redelivered after AckWait.
+	RetryPolicy *RetryPolicy
+
+	// MaxDeliver is the number of deliveries after which a message that keeps
+	// failing is moved to DeadLetterSubject. Zero means no limit.
+	MaxDeliver int
+	// DeadLetterSubject defaults to "<dead letter stream>.<SubscriptionName>".
+	DeadLetterSubject string
+
+	// PanicPolicy decides what happens to a message whose handler panicked.
+	PanicPolicy PanicPolicy
+
+	// DeliverPolicy is where in the stream a new consumer starts. StartTime
+	// and StartSequence go with the by start time and by start sequence
+	// policies.
+	DeliverPolicy nats.DeliverPolicy
+	StartTime     time.Time
+	StartSequence uint64
+	// AckWait is how long the server waits for an ack before redelivering.
+	AckWait time.Duration
+	// MaxAckPending limits the messages delivered but not yet acked.
+	// Zero uses the server default.
+	MaxAckPending int
+	// BackOff lists the redelivery delays used when a message is not acked
+	// in time. It overrides AckWait for redeliveries, and requires a
+	// MaxDeliver above the number of delays.
+	BackOff []time.Duration
+	// FilterSubjects narrows the consumer down. It defaults to Queue.
+	FilterSubjects []string
+	// ReplayPolicy is the pace at which stored messages are delivered.
+	ReplayPolicy nats.ReplayPolicy
+	// InactiveThreshold removes the consumer after it was not used for
+	// that long. Zero keeps it forever.
+	InactiveThreshold time.Duration
+
+	// StatsEvery is how often the consumer info is read for the lag metrics.
+	StatsEvery time.Duration
+	// Buckets are the boundaries, in seconds, of the task_duration histogram
+	// of the event. Nil keeps the default boundaries.
+	Buckets []float64
+	// Timeout is the deadline of the context passed to the handler. It must
+	// be shorter than AckWait, unless InProgressInterval is set.
+	Timeout time.Duration
+	// InProgressInterval is how often the server is told the message is
+	// still being worked on, resetting its AckWait. Use it for handlers that
+	// legitimately run longer than AckWait.
+	InProgressInterval time.Duration
+
+	registry   *Registry          // provides the global middlewares
+	stop       context.CancelFunc // stops fetching new messages
+	abort      context.CancelFunc // cancels the handlers still running
+	done       chan struct{}      // closed once every worker has returned
+	subscribed chan struct{}      // closed once the subscription is created
+}
+
+// SubscribeAndListen subscribes to a PubSubEvent.
+func (e *PubSubEvent) SubscribeAndListen(ctx context.Context, broker pubsub.Broker, config *config.Config, errc chan<- error) {
+	e.Broker = broker
+	e.setDefaults(config)
+
+	if err := e.validate(); err != nil {
+		errc <- fmt.Errorf("subscription %s: %w", e.SubscriptionName, err)
+		return
+	}
+
+	if err := metrics.RegisterEvent(e.Name, e.Buckets); err != nil {
+		log.Warnf("%s: register metrics: %v", e.Name, err)
+	}
+
+	fetchCtx, stop := context.WithCancel(ctx)
+	handleCtx, abort := context.WithCancel(ctx)
+	e.stop, e.abort = stop, abort
+	e.done = make(chan struct{})
+	e.subscribed = make(chan struct{})
+
+	go e.receive(fetchCtx, handleCtx, errc)
+}
+
+// Subscribed reports whether the subscription of the event was created.
+func (e *PubSubEvent) Subscribed() bool {
+	if e.subscribed == nil {
+		return false
+	}
+
+	select {
+	case <-e.subscribed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Shutdown stops fetching new messages and waits for the fetched ones to be
+// handled. When ctx is done before that, the running handlers are cancelled
+// and their messages, like the ones still queued, are nacked so they are
+// redelivered quickly.
+func (e *PubSubEvent) Shutdown(ctx context.Context) {
+	if e.stop == nil {
+		return
+	}
+
+	e.stop()
+
+	select {
+	case <-e.done:
+	case <-ctx.Done():
+		log.Warnf("%s: shutdown deadline exceeded, nacking remaining messages", e.Name)
+		e.abort()
+		<-e.done
+	}
+
+	e.abort()
+}
+
+// setDefaults fills the receiver settings that are not set on the event.
+func (e *PubSubEvent) setDefaults(config *config.Config) {
+	if e.Workers <= 0 {
+		e.Workers = config.PubSubWorkers
+	}
+	if e.QueueSize <= 0 {
+		e.QueueSize = config.PubSubQueueSize
+	}
+	if e.FetchBatch <= 0 {
+		e.FetchBatch = config.PubSubFetchBatch
+	}
+	if e.FetchMaxWait <= 0 {
+		e.FetchMaxWait = config.PubSubFetchMaxWait
+	}
+	if e.PanicPolicy == "" {
+		e.PanicPolicy = PanicPolicy(config.PubSubPanicPolicy)
+	}
+	if e.MaxDeliver > 0 && e.DeadLetterSubject == "" {
+		e.DeadLetterSubject = fmt.Sprintf("%s.%s", config.NatsDeadLetterStream, e.SubscriptionName)
+	}
+	if e.AckWait <= 0 {
+		e.AckWait = config.PubSubAckWait
+	}
+	if e.Timeout <= 0 {
+		e.Timeout = config.PubSubTimeout
+	}
+	if e.BatchSize <= 0 {
+		e.BatchSize = e.FetchBatch
+	}
+	if e.BatchLinger <= 0 {
+		e.BatchLinger = e.FetchMaxWait
+	}
+	if e.StatsEvery <= 0 {
+		e.StatsEvery = config.PubSubStatsEvery
+	}
+}
+
+// validate rejects unknown policies, middlewares that would be ignored and
+// backoffs the server would refuse, and makes sure the server does not
+// redeliver a message while the first attempt may still be running.
+func (e *PubSubEvent) validate() error {
+	if e.Handler == nil && e.BatchHandler == nil {
+		return errors.New("either a handler or a batch handler is required")
+	}
+	if e.BatchHandler != nil && len(e.Middlewares) > 0 {
+		return errors.New("middlewares do not apply to a batch handler")
+	}
+
+	switch e.PanicPolicy {
+	case PanicPolicyNak, PanicPolicyTerm:
+	default:
+		return fmt.Errorf("unknown panic policy %q", e.PanicPolicy)
+	}
+	if v, ok := e.Handler.(validator); ok {
+		if err := v.validate(); err != nil {
+			return err
+		}
+	}
+
+	// The server rejects consumers whose backoff has as many delays as
+	// deliveries, or that redeliver forever
+	if len(e.BackOff) > 0 && e.MaxDeliver <= len(e.BackOff) {
+		return fmt.Errorf("max deliver %d must be greater than the %d backoff delays", e.MaxDeliver, len(e.BackOff))
+	}
+
+	// The server waits for the first backoff delay instead of AckWait
+	ackWait := e.AckWait
+	if len(e.BackOff) > 0 {
+		ackWait = e.BackOff[0]
+	}
+
+	if e.InProgressInterval > 0 {
+		if e.InProgressInterval >= ackWait {
+			return fmt.Errorf("in progress interval %s must be shorter than ack wait %s", e.InProgressInterval, ackWait)
+		}
+		return nil
+	}
+
+	if e.Timeout >= ackWait {
+		return fmt.Errorf("timeout %s must be shorter than ack wait %s", e.Timeout, ackWait)
+	}
+
+	return nil
+}
+
+// settle acks, naks or terminates the message depending on the error
+// returned by the handler, and returns how handling it ended.
+func (e *PubSubEvent) settle(msg pubsub.Message, err error, timedOut bool) metrics.Outcome {
+	if err == nil {
+		_ = msg.Ack()
+		return metrics.OutcomeAck
+	}
+
+	var errNonRecoverable example.ErrNonRecoverable
+	var errPanic PanicError
+
+	// A panic is either retried like a recoverable error or terminated,
+	// depending on the PanicPolicy
+	if errors.As(err, &errPanic) && e.PanicPolicy == PanicPolicyTerm {
+		_ = msg.Term()
+		return outcomeOf(err, timedOut, metrics.OutcomeTerm)
+	}
+
+	// If the error is not a non-recoverable error, it means it is
+	// recoverable, so redeliver instead of acking
+	if !errors.As(err, &errNonRecoverable) {
+		return outcomeOf(err, timedOut, e.redeliver(msg, err))
+	}
+
+	_ = msg.Ack()
+	return outcomeOf(err, timedOut, metrics.OutcomeTerm)
+}
+
+// Bounds of the delay between fetches that keep failing.
+const (
+	minFetchBackoff = 100 * time.Millisecond
+	maxFetchBackoff = 10 * time.Second
+)
+
+// nextFetchBackoff doubles the delay after a failed fetch, up to
+// maxFetchBackoff.
+func nextFetchBackoff(backoff time.Duration) time.Duration {
+	if backoff < minFetchBackoff {
+		return minFetchBackoff
+	}
+	if backoff *= 2; backoff > maxFetchBackoff {
+		return maxFetchBackoff
+	}
+	return backoff
+}
+
+// isFetchTimeout reports whether err means the fetch found no messages
+// before its deadline.
+func isFetchTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, nats.ErrTimeout)
+}
+
+// aborted reports whether Shutdown gave up waiting and cancelled the
+// handlers. Their messages are then nacked so they are redelivered quickly,
+// without counting as a failed delivery.
+func aborted(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.Canceled)
+}
+
+// outcomeOf labels how handling a message that failed with err ended.
+// Panics, timeouts and expected errors are labeled as such whatever happened
+// to the message.
+func outcomeOf(err error, timedOut bool, settled metrics.Outcome) metrics.Outcome {
+	var errPanic PanicError
+	var errExpected example.ErrExpected
+
+	switch {
+	case errors.As(err, &errPanic):
+		return metrics.OutcomePanic
+	case timedOut:
+		return metrics.OutcomeTimeout
+	case errors.As(err, &errExpected):
+		return metrics.OutcomeExpectedError
+	}
+
+	return settled
+}
+
+// recordConsumerStats reads the consumer info every StatsEvery and reports
+// it to the lag metrics until ctx is done.
+func (e *PubSubEvent) recordConsumerStats(ctx context.Context, sub pubsub.Subscriber) {
+	ticker := time.NewTicker(e.StatsEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		stats, err := sub.Stats(ctx)
+		if err != nil {
+			log.Warnf("%s: read consumer stats: %v", e.Name, err)
+			continue
+		}
+
+		metrics.SetConsumerStats(e.Name, metrics.ConsumerStats{
+			Pending:     stats.Pending,
+			AckPending:  stats.AckPending,
+			Redelivered: stats.Redelivered,
+		})
+	}
+}
+
+// inProgress tells the server every InProgressInterval that the message is
+// still being handled, until the returned function is called.
+func (e *PubSubEvent) inProgress(msg pubsub.Message) (stop func()) {
+	if e.InProgressInterval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(e.InProgressInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				_ = msg.InProgress()
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+func (e *PubSubEvent) receive(fetchCtx, handleCtx context.Context, errc chan<- error) {
+	defer close(e.done)
+
+	globals := DefaultMiddlewares()
+	if e.registry != nil {
+		globals = e.registry.middlewares
+	}
+	middlewares := append(append([]Middleware{}, globals...), e.Middlewares...)
+	chain := Chain(e.Handler, middlewares...)
+
+	handler := func(ctx context.Context, msg pubsub.Message) {
+		if e.exceeded(msg) {
+			e.deadLetter(msg, errMaxDeliver)
+			return
+		}
+
+		ctx = withEventName(ctx, e.Name)
+		ctx = pubsub.WithMessage(ctx, msg)
+
+		outcome := metrics.OutcomeAck
+		start := time.Now()
+		defer func() {
+			duration := time.Since(start)
+			metrics.ObserveTimeToProcess(ctx, e.Name, outcome, duration.Seconds())
+		}()
+
+		handleCtx, cancel := context.WithTimeout(ctx, e.Timeout)
+		stopInProgress := e.inProgress(msg)
+		// Panics raised by the middlewares themselves are recovered here
+		err := safeHandle(handleCtx, chain, msg.Data)
+		timedOut := errors.Is(handleCtx.Err(), context.DeadlineExceeded)
+		stopInProgress()
+		cancel()
+
+		if err != nil && aborted(ctx) {
+			_ = msg.Nak()
+			outcome = metrics.OutcomeNak
+			return
+		}
+
+		outcome = e.settle(msg, err, timedOut)
+	}
+
+	sub, err := e.Broker.Subscribe(fetchCtx, e.Queue, e.consumerConfig())
+	if err != nil {
+		errc <- fmt.Errorf("subscription receive(%s): %w", e.SubscriptionName, err)
+		return
+	}
+	close(e.subscribed)
+
+	go e.recordConsumerStats(fetchCtx, sub)
+
+	var wg sync.WaitGroup
+	partitions := newPartitioner(e.PartitionKey, e.Workers, e.QueueSize)
+	metrics.RegisterWorkerQueue(e.Name, partitions.size)
+	worker := func(ctx context.Context, queue chan pubsub.Message) {
+		defer wg.Done()
+		for msg := range queue {
+			// Shutdown gave up waiting, hand the message back to the server
+			if ctx.Err() != nil {
+				_ = msg.Nak()
+				continue
+			}
+			handler(ctx, msg)
+		}
+	}
+	if e.BatchHandler != nil {
+		worker = func(ctx context.Context, queue chan pubsub.Message) {
+			defer wg.Done()
+			for {
+				batch, ok := e.collect(queue)
+				batch = e.deadLetterExceeded(batch)
+				switch {
+				case len(batch) == 0:
+				case ctx.Err() != nil:
+					// Shutdown gave up waiting, hand the messages back
+					for _, msg := range batch {
+						_ = msg.Nak()
+					}
+				default:
+					e.handleBatch(ctx, batch)
+				}
+				if !ok {
+					return
+				}
+			}
+		}
+	}
+
+	wg.Add(e.Workers)
+	for i := 0; i < e.Workers; i++ {
+		go worker(handleCtx, partitions.queue(i))
+	}
+
+	var backoff time.Duration
+	for fetchCtx.Err() == nil {
+		ctx, cancel := context.WithTimeout(fetchCtx, e.FetchMaxWait)
+		msgs, err := sub.Fetch(ctx, e.FetchBatch)
+		cancel()
+
+		for _, msg := range msgs {
+			partitions.dispatch(msg)
+		}
+
+		// A fetch ending without messages is not an error, anything else,
+		// such as a closed connection, is retried less and less often
+		if err == nil || isFetchTimeout(err) || fetchCtx.Err() != nil {
+			backoff = 0
+			continue
+		}
+
+		backoff = nextFetchBackoff(backoff)
+		log.Warnf("%s: fetch: %v, retrying in %s", e.Name, err, backoff)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-fetchCtx.Done():
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+
+	partitions.close()
+	wg.Wait()
+}
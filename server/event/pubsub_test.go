@@ -0,0 +1,167 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"template-subscriber-go/client/pubsub"
+	"template-subscriber-go/config"
+	"testing"
+	"time"
+)
+
+// testConfig returns the receiver defaults of the config, scaled down so
+// tests run fast.
+func testConfig() *config.Config {
+	return &config.Config{
+		NatsDeadLetterStream: "dead-letter",
+		PubSubWorkers:        2,
+		PubSubQueueSize:      1,
+		PubSubFetchBatch:     10,
+		PubSubFetchMaxWait:   50 * time.Millisecond,
+		PubSubPanicPolicy:    string(PanicPolicyNak),
+		PubSubAckWait:        time.Second,
+		PubSubTimeout:        500 * time.Millisecond,
+		PubSubStatsEvery:     time.Minute,
+	}
+}
+
+// listen starts the event on the broker and waits until it is subscribed.
+// It is shut down when the test ends.
+func listen(t *testing.T, e *PubSubEvent, broker pubsub.Broker) {
+	t.Helper()
+
+	errc := make(chan error, 1)
+	e.SubscribeAndListen(context.Background(), broker, testConfig(), errc)
+	t.Cleanup(func() {
+		e.Shutdown(context.Background())
+	})
+
+	eventually(t, "the event to subscribe", func() bool {
+		select {
+		case err := <-errc:
+			t.Fatalf("listen: %v", err)
+		default:
+		}
+		return e.Subscribed()
+	})
+}
+
+// eventually waits until cond holds, failing the test after a few seconds.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func publishData(t *testing.T, broker pubsub.Broker, subject string, n int) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		if _, err := broker.Publish(context.Background(), pubsub.Message{Subject: subject, Data: []byte("data")}); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+}
+
+func TestPubSubEventAck(t *testing.T) {
+	broker := pubsub.NewMemoryBroker()
+	e := &PubSubEvent{
+		Name:             "Ack",
+		Queue:            "orders",
+		SubscriptionName: "ack",
+		Handler: HandlerFunc(func(context.Context, []byte) error {
+			return nil
+		}),
+	}
+	listen(t, e, broker)
+
+	publishData(t, broker, "orders", 3)
+
+	eventually(t, "3 acks", func() bool {
+		return broker.Settlements("ack").Acked == 3
+	})
+}
+
+func TestPubSubEventDeadLetter(t *testing.T) {
+	broker := pubsub.NewMemoryBroker()
+	var calls atomic.Int32
+	e := &PubSubEvent{
+		Name:             "DeadLetter",
+		Queue:            "orders",
+		SubscriptionName: "dead",
+		MaxDeliver:       3,
+		RetryPolicy:      &RetryPolicy{InitialDelay: 10 * time.Millisecond},
+		Handler: HandlerFunc(func(context.Context, []byte) error {
+			calls.Add(1)
+			return errors.New("boom")
+		}),
+	}
+	listen(t, e, broker)
+
+	publishData(t, broker, "orders", 1)
+
+	eventually(t, "the message to be dead lettered", func() bool {
+		return len(broker.Messages("dead-letter.dead")) == 1
+	})
+
+	dlq := broker.Messages("dead-letter.dead")[0]
+	if got := dlq.Header.Get(HeaderDeadLetterDeliveries); got != "3" {
+		t.Errorf("got %s deliveries, want 3", got)
+	}
+	if got := dlq.Header.Get(HeaderDeadLetterReason); got != "boom" {
+		t.Errorf("got reason %q, want boom", got)
+	}
+
+	got := broker.Settlements("dead")
+	if got.Nacked != 2 || got.Terminated != 1 {
+		t.Errorf("got settlements %+v, want 2 nacked and 1 terminated", got)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("handler called %d times, want 3", n)
+	}
+}
+
+func TestPubSubEventShutdownNaksAborted(t *testing.T) {
+	broker := pubsub.NewMemoryBroker()
+	var running atomic.Int32
+	e := &PubSubEvent{
+		Name:             "Abort",
+		Queue:            "orders",
+		SubscriptionName: "abort",
+		Workers:          4,
+		MaxDeliver:       1,
+		Timeout:          time.Minute,
+		AckWait:          2 * time.Minute,
+		Handler: HandlerFunc(func(ctx context.Context, _ []byte) error {
+			running.Add(1)
+			<-ctx.Done()
+			return ctx.Err()
+		}),
+	}
+	listen(t, e, broker)
+
+	publishData(t, broker, "orders", 8)
+	eventually(t, "4 running handlers", func() bool {
+		return running.Load() == 4
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	e.Shutdown(ctx)
+
+	// Every fetched message is handed back, whether it was running or queued
+	got := broker.Settlements("abort")
+	if got.Nacked < 4 || got.Acked != 0 || got.Terminated != 0 {
+		t.Errorf("got settlements %+v, want every fetched message nacked", got)
+	}
+	if msgs := broker.Messages("dead-letter.>"); len(msgs) != 0 {
+		t.Errorf("got %d dead lettered messages, want none", len(msgs))
+	}
+}
@@ -0,0 +1,208 @@
+package event
+
+import (
+	"fmt"
+	"template-subscriber-go/client/pubsub"
+	"time"
+)
+
+// Registry holds the pubsub and app events a server subscribes to and runs,
+// and the middlewares wrapping the handler of every pubsub event.
+//
+// Events are registered before the server starts serving. Registering two
+// events of the same kind with the same name panics.
+type Registry struct {
+	pubSubEvents PubSubEvents
+	appEvents    AppEvents
+	middlewares  []Middleware
+}
+
+// NewRegistry returns a registry without events, whose global middlewares
+// are the DefaultMiddlewares.
+func NewRegistry() *Registry {
+	return &Registry{
+		middlewares: DefaultMiddlewares(),
+	}
+}
+
+// Use adds global middlewares, wrapped by the ones already added and
+// wrapping the middlewares of each event.
+func (r *Registry) Use(middlewares ...Middleware) {
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
+// PubSubOption configures a pubsub event registered with RegisterPubSub.
+// Any field of the PubSubEvent can be set with a function of this type.
+type PubSubOption func(*PubSubEvent)
+
+// RegisterPubSub registers a pubsub event handling the messages of subject
+// received through the durable consumer. The handler may be nil when the
+// event is given a BatchHandler.
+func (r *Registry) RegisterPubSub(name, subject, durable string, handler Handler, opts ...PubSubOption) {
+	for i := range r.pubSubEvents {
+		if r.pubSubEvents[i].Name == name {
+			panic(fmt.Sprintf("event: pubsub event %s registered twice", name))
+		}
+	}
+
+	r.pubSubEvents = append(r.pubSubEvents, PubSubEvent{
+		Name:             name,
+		Queue:            subject,
+		SubscriptionName: durable,
+		Handler:          handler,
+		registry:         r,
+	})
+
+	e := &r.pubSubEvents[len(r.pubSubEvents)-1]
+	for _, opt := range opts {
+		opt(e)
+	}
+}
+
+// PubSubEvents returns the registered pubsub events.
+func (r *Registry) PubSubEvents() PubSubEvents {
+	return r.pubSubEvents
+}
+
+// WithMiddlewares adds middlewares wrapping the handler of the event only.
+func WithMiddlewares(middlewares ...Middleware) PubSubOption {
+	return func(e *PubSubEvent) {
+		e.Middlewares = append(e.Middlewares, middlewares...)
+	}
+}
+
+// WithRetryPolicy naks messages failing with a recoverable error with the
+// delay of the policy.
+func WithRetryPolicy(policy RetryPolicy) PubSubOption {
+	return func(e *PubSubEvent) {
+		e.RetryPolicy = &policy
+	}
+}
+
+// WithMaxDeliver moves messages to the dead letter subject once they were
+// delivered n times.
+func WithMaxDeliver(n int) PubSubOption {
+	return func(e *PubSubEvent) {
+		e.MaxDeliver = n
+	}
+}
+
+// WithDeadLetterSubject sets the subject messages exceeding MaxDeliver are
+// published to.
+func WithDeadLetterSubject(subject string) PubSubOption {
+	return func(e *PubSubEvent) {
+		e.DeadLetterSubject = subject
+	}
+}
+
+// WithWorkers sets how many messages of the event are handled at once.
+func WithWorkers(n int) PubSubOption {
+	return func(e *PubSubEvent) {
+		e.Workers = n
+	}
+}
+
+// WithPartitionKey hands the messages with the same key to the same worker,
+// one at a time.
+func WithPartitionKey(key func(pubsub.Message) string) PubSubOption {
+	return func(e *PubSubEvent) {
+		e.PartitionKey = key
+	}
+}
+
+// WithBatchHandler hands up to size messages at once to h, waiting at most
+// linger for a batch to fill up. It cannot be combined with WithMiddlewares.
+func WithBatchHandler(h BatchHandler, size int, linger time.Duration) PubSubOption {
+	return func(e *PubSubEvent) {
+		e.BatchHandler = h
+		e.BatchSize = size
+		e.BatchLinger = linger
+	}
+}
+
+// WithTimeout sets the deadline of the context passed to the handler.
+func WithTimeout(d time.Duration) PubSubOption {
+	return func(e *PubSubEvent) {
+		e.Timeout = d
+	}
+}
+
+// AppOption configures an app event registered with RegisterApp. Any field
+// of the AppEvent can be set with a function of this type.
+type AppOption func(*AppEvent)
+
+// RegisterApp registers an app event running handler on the schedule set
+// by its options, either WithRate or WithCron.
+func (r *Registry) RegisterApp(name string, handler Handler, opts ...AppOption) {
+	for i := range r.appEvents {
+		if r.appEvents[i].Name == name {
+			panic(fmt.Sprintf("event: app event %s registered twice", name))
+		}
+	}
+
+	r.appEvents = append(r.appEvents, AppEvent{
+		Name:    name,
+		Handler: handler,
+	})
+
+	e := &r.appEvents[len(r.appEvents)-1]
+	for _, opt := range opts {
+		opt(e)
+	}
+}
+
+// AppEvents returns the registered app events.
+func (r *Registry) AppEvents() AppEvents {
+	return r.appEvents
+}
+
+// WithRate runs the app event at a fixed rate.
+func WithRate(rate time.Duration) AppOption {
+	return func(e *AppEvent) {
+		e.Rate = rate
+	}
+}
+
+// WithCron runs the app event on a cron schedule.
+func WithCron(expr string) AppOption {
+	return func(e *AppEvent) {
+		e.Cron = expr
+	}
+}
+
+// WithOverlap sets what happens when a run is due while the previous one is
+// still going.
+func WithOverlap(policy OverlapPolicy) AppOption {
+	return func(e *AppEvent) {
+		e.Overlap = policy
+	}
+}
+
+// WithJitter delays each run by a random duration up to jitter.
+func WithJitter(jitter time.Duration) AppOption {
+	return func(e *AppEvent) {
+		e.Jitter = jitter
+	}
+}
+
+// WithRunOnStart runs the app event as soon as it starts.
+func WithRunOnStart() AppOption {
+	return func(e *AppEvent) {
+		e.RunOnStart = true
+	}
+}
+
+// WithRunTimeout sets the deadline of the context passed to the handler on
+// each run.
+func WithRunTimeout(d time.Duration) AppOption {
+	return func(e *AppEvent) {
+		e.Timeout = d
+	}
+}
+
+// WithLeader runs the app event on the elected replica only.
+func WithLeader(leader Elector) AppOption {
+	return func(e *AppEvent) {
+		e.Leader = leader
+	}
+}
@@ -0,0 +1,94 @@
+package event
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"template-subscriber-go/client/pubsub"
+	"template-subscriber-go/monitoring/metrics"
+	"time"
+)
+
+var (
+	jitterMu   sync.Mutex
+	jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// RetryPolicy describes how long a message that failed with a recoverable
+// error waits before it is redelivered. The delay grows exponentially with
+// the number of deliveries of the message.
+type RetryPolicy struct {
+	// InitialDelay is the delay after the first failed delivery.
+	InitialDelay time.Duration
+	// Multiplier is applied to the delay on every further delivery.
+	// Values below 1 keep the delay constant.
+	Multiplier float64
+	// MaxDelay caps the delay. Zero means no cap.
+	MaxDelay time.Duration
+	// Jitter is the fraction of the delay, between 0 and 1, by which it is
+	// randomly increased or decreased so retries of a batch spread out.
+	Jitter float64
+}
+
+// Delay returns how long to wait before redelivering a message that has
+// been delivered numDelivered times.
+func (p RetryPolicy) Delay(numDelivered uint64) time.Duration {
+	multiplier := math.Max(p.Multiplier, 1)
+	attempt := math.Max(float64(numDelivered), 1) - 1
+
+	delay := float64(p.InitialDelay) * math.Pow(multiplier, attempt)
+	// Keeps the jitter below from turning an infinite delay into NaN
+	delay = math.Min(delay, float64(math.MaxInt64))
+
+	if p.Jitter > 0 {
+		jitterMu.Lock()
+		r := jitterRand.Float64()
+		jitterMu.Unlock()
+		delay += delay * math.Min(p.Jitter, 1) * (2*r - 1)
+	}
+
+	// The cap is applied last so the jitter cannot exceed it
+	if p.MaxDelay > 0 {
+		delay = math.Min(delay, float64(p.MaxDelay))
+	}
+	if delay >= float64(math.MaxInt64) {
+		return time.Duration(math.MaxInt64)
+	}
+
+	return time.Duration(delay)
+}
+
+// errMaxDeliver is the dead letter reason of messages redelivered after
+// their last attempt could not be settled, because the handler crashed or
+// publishing to the dead letter subject failed.
+var errMaxDeliver = errors.New("exceeded max deliveries")
+
+// exceeded reports whether the message was delivered more than MaxDeliver
+// times, so it goes to the dead letter subject without being handled.
+func (e *PubSubEvent) exceeded(msg pubsub.Message) bool {
+	return e.MaxDeliver > 0 && msg.NumDelivered > uint64(e.MaxDeliver)
+}
+
+// redeliver hands a message that failed with a recoverable error back to
+// the server, or moves it to the dead letter subject once it reached
+// MaxDeliver. It returns which of the two happened.
+func (e *PubSubEvent) redeliver(msg pubsub.Message, cause error) metrics.Outcome {
+	if e.MaxDeliver > 0 && msg.NumDelivered >= uint64(e.MaxDeliver) {
+		return e.deadLetter(msg, cause)
+	}
+
+	e.retry(msg)
+	return metrics.OutcomeNak
+}
+
+// retry naks the message with the delay of the RetryPolicy. Without a
+// RetryPolicy the message is left unacked and redelivered once AckWait
+// expires.
+func (e *PubSubEvent) retry(msg pubsub.Message) {
+	if e.RetryPolicy == nil {
+		return
+	}
+
+	_ = msg.NakWithDelay(e.RetryPolicy.Delay(msg.NumDelivered))
+}
@@ -0,0 +1,78 @@
+package event
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       RetryPolicy
+		numDelivered uint64
+		want         time.Duration
+	}{
+		{
+			name:         "first delivery",
+			policy:       RetryPolicy{InitialDelay: time.Second, Multiplier: 2},
+			numDelivered: 1,
+			want:         time.Second,
+		},
+		{
+			name:         "grows with deliveries",
+			policy:       RetryPolicy{InitialDelay: time.Second, Multiplier: 2},
+			numDelivered: 4,
+			want:         8 * time.Second,
+		},
+		{
+			name:         "capped",
+			policy:       RetryPolicy{InitialDelay: time.Second, Multiplier: 2, MaxDelay: 5 * time.Second},
+			numDelivered: 4,
+			want:         5 * time.Second,
+		},
+		{
+			name:         "overflow without cap",
+			policy:       RetryPolicy{InitialDelay: time.Second, Multiplier: 2},
+			numDelivered: 40,
+			want:         time.Duration(math.MaxInt64),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Delay(tt.numDelivered); got != tt.want {
+				t.Errorf("Delay(%d) = %s, want %s", tt.numDelivered, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDelayJitterCapped(t *testing.T) {
+	policy := RetryPolicy{
+		InitialDelay: time.Second,
+		Multiplier:   2,
+		MaxDelay:     5 * time.Second,
+		Jitter:       1,
+	}
+
+	for i := 0; i < 100; i++ {
+		if got := policy.Delay(10); got > policy.MaxDelay {
+			t.Fatalf("Delay(10) = %s, exceeds max delay %s", got, policy.MaxDelay)
+		}
+	}
+}
+
+func TestRetryPolicyDelayJitterOverflow(t *testing.T) {
+	policy := RetryPolicy{
+		InitialDelay: time.Second,
+		Multiplier:   2,
+		Jitter:       0.5,
+	}
+
+	for i := 0; i < 100; i++ {
+		if got := policy.Delay(5000); got <= 0 {
+			t.Fatalf("Delay(5000) = %s, want a positive delay", got)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"template-subscriber-go/client/pubsub"
+	"template-subscriber-go/example"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrNoRoute is returned by a Router for messages no route matches.
+var ErrNoRoute = errors.New("no route matches the message")
+
+// FallbackPolicy tells what a Router does with messages no route matches.
+type FallbackPolicy string
+
+const (
+	// FallbackTerm treats unmatched messages as non-recoverable.
+	FallbackTerm FallbackPolicy = "term"
+	// FallbackNak treats unmatched messages as recoverable, so they are
+	// retried and end up on the dead letter subject.
+	FallbackNak FallbackPolicy = "nak"
+	// FallbackAck acks unmatched messages without handling them.
+	FallbackAck FallbackPolicy = "ack"
+)
+
+// Router is a Handler dispatching each message to the handler of the first
+// route it matches, in the order the routes were added. It lets a single
+// durable consumer on a wildcard subject such as "orders.>" serve several
+// kinds of messages.
+//
+// Messages no route matches are passed to Fallback when set, and otherwise
+// handled according to FallbackPolicy, which defaults to FallbackTerm. A
+// pubsub event refuses to start with an unknown FallbackPolicy.
+type Router struct {
+	Fallback       Handler
+	FallbackPolicy FallbackPolicy
+
+	routes []route
+}
+
+type route struct {
+	match   func(pubsub.Message) bool
+	handler Handler
+}
+
+// NewRouter returns a router without routes.
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Subject routes the messages whose subject matches pattern, which may use
+// the "*" and ">" wildcards, to h.
+func (r *Router) Subject(pattern string, h Handler) *Router {
+	return r.Match(func(msg pubsub.Message) bool {
+		return pubsub.SubjectMatches(pattern, msg.Subject)
+	}, h)
+}
+
+// Header routes the messages whose header key has value to h.
+func (r *Router) Header(key, value string, h Handler) *Router {
+	return r.Match(func(msg pubsub.Message) bool {
+		return msg.Header.Get(key) == value
+	}, h)
+}
+
+// Type routes the messages whose Message-Type header is the full name of a
+// protobuf message to h.
+func (r *Router) Type(fullName string, h Handler) *Router {
+	return r.Header(pubsub.HeaderMessageType, fullName, h)
+}
+
+// Match routes the messages for which match returns true to h.
+func (r *Router) Match(match func(pubsub.Message) bool, h Handler) *Router {
+	r.routes = append(r.routes, route{
+		match:   match,
+		handler: h,
+	})
+
+	return r
+}
+
+// RouteType routes the messages of type T, as told by their Message-Type
+// header, to h once decoded.
+func RouteType[T proto.Message](r *Router, h ProtoHandler[T]) *Router {
+	var zero T
+	name := zero.ProtoReflect().Descriptor().FullName()
+
+	return r.Type(string(name), TypedHandler[T]{Handler: h})
+}
+
+// Handle passes the message to the handler of the first matching route.
+func (r *Router) Handle(ctx context.Context, data []byte) error {
+	msg, ok := pubsub.MessageFromContext(ctx)
+	if !ok {
+		msg = pubsub.Message{Data: data}
+	}
+
+	for _, route := range r.routes {
+		if route.match(msg) {
+			return route.handler.Handle(ctx, data)
+		}
+	}
+
+	if r.Fallback != nil {
+		return r.Fallback.Handle(ctx, data)
+	}
+
+	err := fmt.Errorf("%w: subject %s", ErrNoRoute, msg.Subject)
+	switch r.FallbackPolicy {
+	case FallbackAck:
+		return nil
+	case FallbackNak:
+		return err
+	default:
+		return example.ErrNonRecoverable{
+			Err: err,
+		}
+	}
+}
+
+// validator is implemented by handlers whose settings are checked before
+// their event starts.
+type validator interface {
+	validate() error
+}
+
+// validate rejects an unknown FallbackPolicy, in this router and in the
+// routers it dispatches to.
+func (r *Router) validate() error {
+	switch r.FallbackPolicy {
+	case "", FallbackTerm, FallbackNak, FallbackAck:
+	default:
+		return fmt.Errorf("unknown fallback policy %q", r.FallbackPolicy)
+	}
+
+	handlers := []Handler{r.Fallback}
+	for _, route := range r.routes {
+		handlers = append(handlers, route.handler)
+	}
+	for _, h := range handlers {
+		if v, ok := h.(validator); ok {
+			if err := v.validate(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,187 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"template-subscriber-go/client/pubsub"
+	"template-subscriber-go/example"
+	"template-subscriber-go/example/pb/fakeapi"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"google.golang.org/protobuf/proto"
+)
+
+// routed returns a handler recording its name into got.
+func routed(name string, got *string) Handler {
+	return HandlerFunc(func(context.Context, []byte) error {
+		*got = name
+		return nil
+	})
+}
+
+// dispatch passes a message with subject, header and data to r, and returns
+// the error of the handler.
+func dispatch(r *Router, subject string, header nats.Header, data []byte) error {
+	ctx := pubsub.WithMessage(context.Background(), pubsub.Message{
+		Subject: subject,
+		Header:  header,
+		Data:    data,
+	})
+
+	return r.Handle(ctx, data)
+}
+
+func TestRouterSubject(t *testing.T) {
+	var got string
+	r := NewRouter().
+		Subject("orders.*.created", routed("created", &got)).
+		Subject("orders.>", routed("orders", &got))
+	r.Fallback = routed("fallback", &got)
+
+	tests := []struct {
+		subject string
+		want    string
+	}{
+		{"orders.1.created", "created"},
+		{"orders.1.paid", "orders"},
+		{"orders.1.created.late", "orders"},
+		{"orders", "fallback"},
+		{"payments.1.created", "fallback"},
+	}
+	for _, tt := range tests {
+		got = ""
+		if err := dispatch(r, tt.subject, nil, nil); err != nil {
+			t.Fatalf("%s: %v", tt.subject, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: routed to %q, want %q", tt.subject, got, tt.want)
+		}
+	}
+}
+
+func TestRouterHeaderAndType(t *testing.T) {
+	var got string
+	var decoded *fakeapi.FakeData
+	r := NewRouter().Header("Source", "legacy", routed("legacy", &got))
+	RouteType[*fakeapi.FakeData](r, handleFake(func(_ context.Context, msg *fakeapi.FakeData) error {
+		got, decoded = "fake", msg
+		return nil
+	}))
+	r.Fallback = routed("fallback", &got)
+
+	data, err := proto.Marshal(&fakeapi.FakeData{IsFake: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		header nats.Header
+		want   string
+	}{
+		{"header", nats.Header{"Source": []string{"legacy"}}, "legacy"},
+		{"type", nats.Header{pubsub.HeaderMessageType: []string{"fakeapi.FakeData"}}, "fake"},
+		{"other type", nats.Header{pubsub.HeaderMessageType: []string{"fakeapi.Other"}}, "fallback"},
+		{"no header", nil, "fallback"},
+	}
+	for _, tt := range tests {
+		got = ""
+		if err := dispatch(r, "orders", tt.header, data); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: routed to %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if !decoded.GetIsFake() {
+		t.Errorf("got %v, want the decoded message", decoded)
+	}
+}
+
+func TestRouterFirstMatch(t *testing.T) {
+	var got string
+	r := NewRouter().
+		Header("Source", "legacy", routed("legacy", &got)).
+		Subject("orders.>", routed("orders", &got)).
+		Subject("orders.1", routed("order 1", &got))
+
+	if err := dispatch(r, "orders.1", nats.Header{"Source": []string{"legacy"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got != "legacy" {
+		t.Errorf("routed to %q, want legacy", got)
+	}
+
+	if err := dispatch(r, "orders.1", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got != "orders" {
+		t.Errorf("routed to %q, want orders", got)
+	}
+}
+
+func TestRouterFallbackPolicy(t *testing.T) {
+	tests := []struct {
+		policy         FallbackPolicy
+		wantErr        bool
+		nonRecoverable bool
+	}{
+		{"", true, true},
+		{FallbackTerm, true, true},
+		{FallbackNak, true, false},
+		{FallbackAck, false, false},
+	}
+	for _, tt := range tests {
+		r := NewRouter().Subject("orders", HandlerFunc(func(context.Context, []byte) error {
+			t.Error("unmatched message routed")
+			return nil
+		}))
+		r.FallbackPolicy = tt.policy
+
+		err := dispatch(r, "payments", nil, nil)
+		if !tt.wantErr {
+			if err != nil {
+				t.Errorf("policy %q: got error %v, want none", tt.policy, err)
+			}
+			continue
+		}
+
+		if !errors.Is(err, ErrNoRoute) {
+			t.Errorf("policy %q: got error %v, want ErrNoRoute", tt.policy, err)
+		}
+		var errNonRecoverable example.ErrNonRecoverable
+		if got := errors.As(err, &errNonRecoverable); got != tt.nonRecoverable {
+			t.Errorf("policy %q: got non-recoverable %t, want %t", tt.policy, got, tt.nonRecoverable)
+		}
+	}
+}
+
+func TestRouterRejectsUnknownFallbackPolicy(t *testing.T) {
+	newEvent := func(h Handler) *PubSubEvent {
+		return &PubSubEvent{
+			Handler:     h,
+			PanicPolicy: PanicPolicyNak,
+			AckWait:     time.Minute,
+			Timeout:     time.Second,
+		}
+	}
+
+	valid := NewRouter()
+	valid.FallbackPolicy = FallbackNak
+	if err := newEvent(valid).validate(); err != nil {
+		t.Errorf("got error %v for a known policy", err)
+	}
+
+	unknown := NewRouter()
+	unknown.FallbackPolicy = "drop"
+	if err := newEvent(unknown).validate(); err == nil {
+		t.Error("got no error for an unknown policy")
+	}
+
+	// Routers dispatching to a misconfigured router are rejected too
+	if err := newEvent(NewRouter().Subject("orders.>", unknown)).validate(); err == nil {
+		t.Error("got no error for an unknown policy of a nested router")
+	}
+}
@@ -0,0 +1,73 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"template-subscriber-go/client/pubsub"
+	"template-subscriber-go/example"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// ProtoHandler handles messages already decoded into a T.
+type ProtoHandler[T proto.Message] interface {
+	Handle(ctx context.Context, msg T) error
+}
+
+// TypedHandler is a Handler decoding the payload into a T before passing it
+// to the ProtoHandler. The encoding is picked from the Content-Type header
+// and defaults to protobuf. JSON is decoded with the protobuf JSON mapping,
+// ignoring unknown fields. Payloads that cannot be decoded are
+// non-recoverable.
+type TypedHandler[T proto.Message] struct {
+	Handler ProtoHandler[T]
+}
+
+// Handle decodes data and calls the ProtoHandler.
+func (h TypedHandler[T]) Handle(ctx context.Context, data []byte) error {
+	m, _ := pubsub.MessageFromContext(ctx)
+	msg, err := decode[T](m.Header.Get(pubsub.HeaderContentType), data)
+	if err != nil {
+		return example.ErrNonRecoverable{
+			Err: err,
+		}
+	}
+
+	return h.Handler.Handle(ctx, msg)
+}
+
+// decode unmarshals data encoded as contentType into a new T.
+func decode[T proto.Message](contentType string, data []byte) (T, error) {
+	var zero T
+	msg := zero.ProtoReflect().New().Interface().(T)
+	name := msg.ProtoReflect().Descriptor().FullName()
+
+	mediaType := pubsub.ContentTypeProtobuf
+	if contentType != "" {
+		var err error
+		mediaType, _, err = mime.ParseMediaType(contentType)
+		if err != nil {
+			return zero, fmt.Errorf("parse content type %q: %w", contentType, err)
+		}
+	}
+
+	var err error
+	switch mediaType {
+	case pubsub.ContentTypeProtobuf:
+		err = proto.Unmarshal(data, msg)
+	case pubsub.ContentTypeJSON:
+		// Plain JSON producers may send fields T does not know yet
+		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, msg)
+	case pubsub.ContentTypeProtoJSON:
+		err = protojson.Unmarshal(data, msg)
+	default:
+		return zero, fmt.Errorf("unsupported content type %q for %s", contentType, name)
+	}
+	if err != nil {
+		return zero, fmt.Errorf("failed to unmarshal %s: %w", name, err)
+	}
+
+	return msg, nil
+}
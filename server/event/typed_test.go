@@ -0,0 +1,108 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"template-subscriber-go/client/pubsub"
+	"template-subscriber-go/example"
+	"template-subscriber-go/example/pb/fakeapi"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestDecode(t *testing.T) {
+	date := time.Date(2023, 10, 1, 12, 30, 0, 0, time.UTC)
+	want := &fakeapi.FakeData{IsFake: true, Date: timestamppb.New(date)}
+
+	binary, err := proto.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	protoJSON, err := protojson.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		data        []byte
+	}{
+		{"default", "", binary},
+		{"protobuf", pubsub.ContentTypeProtobuf, binary},
+		{"protobuf json", pubsub.ContentTypeProtoJSON, protoJSON},
+		{"json with proto names", pubsub.ContentTypeJSON, []byte(`{"is_fake": true, "date": "2023-10-01T12:30:00Z"}`)},
+		{"json with json names", pubsub.ContentTypeJSON, []byte(`{"isFake": true, "date": "2023-10-01T12:30:00Z"}`)},
+		{"json with unknown fields", pubsub.ContentTypeJSON, []byte(`{"is_fake": true, "date": "2023-10-01T12:30:00Z", "added": 1}`)},
+		{"json with parameters", "application/json; charset=utf-8", []byte(`{"is_fake": true, "date": "2023-10-01T12:30:00Z"}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decode[*fakeapi.FakeData](tt.contentType, tt.data)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if !proto.Equal(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		data        []byte
+	}{
+		{"unsupported content type", "text/plain", []byte("fake")},
+		{"invalid content type", "application/", []byte("{}")},
+		{"invalid protobuf", pubsub.ContentTypeProtobuf, []byte{0xff}},
+		{"invalid json", pubsub.ContentTypeJSON, []byte(`{"is_fake": "yes"}`)},
+		{"unknown field in protobuf json", pubsub.ContentTypeProtoJSON, []byte(`{"added": 1}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decode[*fakeapi.FakeData](tt.contentType, tt.data); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
+
+// handleFake lets a function be used as the ProtoHandler of FakeData.
+type handleFake func(ctx context.Context, msg *fakeapi.FakeData) error
+
+func (f handleFake) Handle(ctx context.Context, msg *fakeapi.FakeData) error {
+	return f(ctx, msg)
+}
+
+func TestTypedHandler(t *testing.T) {
+	var got *fakeapi.FakeData
+	h := TypedHandler[*fakeapi.FakeData]{
+		Handler: handleFake(func(_ context.Context, msg *fakeapi.FakeData) error {
+			got = msg
+			return nil
+		}),
+	}
+
+	ctx := pubsub.WithMessage(context.Background(), pubsub.Message{
+		Header: nats.Header{pubsub.HeaderContentType: []string{pubsub.ContentTypeJSON}},
+	})
+	if err := h.Handle(ctx, []byte(`{"is_fake": true}`)); err != nil {
+		t.Fatalf("handle: %v", err)
+	}
+	if !got.GetIsFake() {
+		t.Errorf("got %v, want a fake", got)
+	}
+
+	var errNonRecoverable example.ErrNonRecoverable
+	if err := h.Handle(ctx, []byte("not json")); !errors.As(err, &errNonRecoverable) {
+		t.Errorf("got error %v, want a non-recoverable one", err)
+	}
+}
@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ProcessedMessagesCleaner removes processed message records.
+type ProcessedMessagesCleaner interface {
+	DeleteProcessedBefore(ctx context.Context, t time.Time) (int64, error)
+}
+
+// DedupCleanup removes the dedup records older than TTL.
+type DedupCleanup struct {
+	DB  ProcessedMessagesCleaner
+	TTL time.Duration
+}
+
+// Handle is the handler for the dedup cleanup app event.
+func (d DedupCleanup) Handle(ctx context.Context, _ []byte) error {
+	deleted, err := d.DB.DeleteProcessedBefore(ctx, time.Now().Add(-d.TTL))
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("Deleted %d processed message records", deleted)
+
+	return nil
+}
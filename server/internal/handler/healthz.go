@@ -1,8 +1,39 @@
 package handler
 
-import "net/http"
+import (
+	"encoding/json"
+	"net/http"
+	"template-subscriber-go/monitoring/health"
+)
 
 func Healthz(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(http.StatusText(http.StatusOK)))
 }
+
+// Livez returns a handler reporting whether every check in the registry
+// passes. Its checks only fail when the process cannot recover by itself,
+// so a broken database does not get the pod restarted.
+func Livez(registry *health.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, registry.Run(r.Context()))
+	}
+}
+
+// Readyz returns a handler reporting whether every check in the registry
+// passes, with the status and latency of each check.
+func Readyz(registry *health.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, registry.Run(r.Context()))
+	}
+}
+
+func writeReport(w http.ResponseWriter, report health.Report) {
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status != health.StatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	_ = json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"template-subscriber-go/client/database"
+	"template-subscriber-go/monitoring/metrics"
+	"template-subscriber-go/server/event"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+)
+
+// OutboxRelayer hands pending outbox messages over for publishing.
+type OutboxRelayer interface {
+	RelayOutbox(ctx context.Context, limit int, retry database.OutboxRetry, publish func(context.Context, database.OutboxMessage) error) (int, error)
+	OldestPendingOutbox(ctx context.Context) (time.Time, error)
+}
+
+// MsgPublisher publishes prebuilt messages.
+type MsgPublisher interface {
+	PublishMsg(ctx context.Context, m *nats.Msg) (*nats.PubAck, error)
+}
+
+// OutboxRelay publishes up to BatchSize pending outbox messages per run.
+// A message that fails to publish is attempted again after the delay of
+// RetryPolicy for its number of attempts, and parked after MaxAttempts.
+// ServiceName scopes the Nats-Msg-Id of messages inserted without one.
+type OutboxRelay struct {
+	ServiceName string
+	DB          OutboxRelayer
+	Publisher   MsgPublisher
+	BatchSize   int
+	MaxAttempts int
+	RetryPolicy event.RetryPolicy
+}
+
+// Handle is the handler for the outbox relay app event.
+func (o OutboxRelay) Handle(ctx context.Context, _ []byte) error {
+	retry := database.OutboxRetry{
+		MaxAttempts: o.MaxAttempts,
+		Delay: func(attempts int) time.Duration {
+			return o.RetryPolicy.Delay(uint64(attempts))
+		},
+	}
+
+	sent, err := o.DB.RelayOutbox(ctx, o.BatchSize, retry, o.publish)
+	if sent > 0 {
+		log.Debugf("Relayed %d outbox messages", sent)
+	}
+
+	// Reported even when messages fail, so a stalled outbox shows
+	oldest, oldestErr := o.DB.OldestPendingOutbox(ctx)
+	if oldestErr != nil {
+		log.Warnf("Failed to get the oldest pending outbox message: %v", oldestErr)
+	} else {
+		metrics.SetOutboxOldestPending(oldest)
+	}
+
+	return err
+}
+
+func (o OutboxRelay) publish(ctx context.Context, m database.OutboxMessage) error {
+	msg := nats.NewMsg(m.Subject)
+	msg.Data = m.Data
+	for key, values := range m.Header {
+		msg.Header[key] = values
+	}
+
+	// The stream drops the message if a previous relay already published
+	// it. InsertOutbox always sets an id, so this only covers rows inserted
+	// otherwise. Their row id is unique within the table only, hence the
+	// service and insertion time.
+	if msg.Header.Get(nats.MsgIdHdr) == "" {
+		msg.Header.Set(nats.MsgIdHdr, fmt.Sprintf("outbox-%s-%d-%d", o.ServiceName, m.ID, m.CreatedAt.UnixNano()))
+	}
+
+	if _, err := o.Publisher.PublishMsg(ctx, msg); err != nil {
+		metrics.OutboxPublishFailed(ctx)
+		if o.MaxAttempts > 0 && m.Attempts+1 >= o.MaxAttempts {
+			log.Errorf("Parked outbox message %d after %d failed attempts: %v", m.ID, m.Attempts+1, err)
+		}
+		return err
+	}
+
+	metrics.OutboxRelayed(ctx, time.Since(m.CreatedAt).Seconds())
+
+	return nil
+}
+
+// OutboxCleaner removes sent outbox messages.
+type OutboxCleaner interface {
+	DeleteSentOutboxBefore(ctx context.Context, t time.Time) (int64, error)
+}
+
+// OutboxCleanup removes the outbox messages sent longer than Retention ago.
+type OutboxCleanup struct {
+	DB        OutboxCleaner
+	Retention time.Duration
+}
+
+// Handle is the handler for the outbox cleanup app event.
+func (o OutboxCleanup) Handle(ctx context.Context, _ []byte) error {
+	deleted, err := o.DB.DeleteSentOutboxBefore(ctx, time.Now().Add(-o.Retention))
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("Deleted %d sent outbox messages", deleted)
+
+	return nil
+}
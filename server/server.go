@@ -1,22 +1,27 @@
 // Package server provides functionality to easily set up a subscriber of pubsub events.
 //
-// The server holds all the clients it needs. The clients should be set up in the Create method.
+// The server holds all the clients it needs. The clients are set up in the Create method,
+// unless given to New.
 package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"template-subscriber-go/client/database"
 	"template-subscriber-go/client/pubsub"
 	"template-subscriber-go/config"
+	"template-subscriber-go/monitoring/health"
 	"template-subscriber-go/monitoring/metrics"
 	"template-subscriber-go/monitoring/trace"
-	"template-subscriber-go/server/internal/event"
+	"template-subscriber-go/server/event"
 	"template-subscriber-go/server/internal/handler"
+	"time"
 
 	metricsdk "go.opentelemetry.io/otel/sdk/metric"
 	tracesdk "go.opentelemetry.io/otel/sdk/trace"
@@ -26,46 +31,227 @@ import (
 )
 
 // Server holds an HTTP server, config and all the clients.
+//
+// Events are registered on the embedded Registry between Create and Serve.
 type Server struct {
+	*event.Registry
+
 	Config          *config.Config
 	HTTP            *http.Server
 	DB              *database.Client
 	PubSub          *pubsub.Client
+	Broker          pubsub.Broker
+	Publisher       *pubsub.Publisher
 	TracerProvider  *tracesdk.TracerProvider
 	MetricsProvider *metricsdk.MeterProvider
+
+	clients      map[string]any
+	noDatabase   bool
+	dedup        bool
+	outbox       bool
+	pubSubEvents event.PubSubEvents
+	appEvents    event.AppEvents
+}
+
+// Option configures a Server created with New.
+type Option func(*Server)
+
+// WithConfig sets the config of the server instead of loading it from the
+// environment.
+func WithConfig(config *config.Config) Option {
+	return func(s *Server) {
+		s.Config = config
+	}
+}
+
+// WithDatabase sets the database client instead of connecting a new one.
+func WithDatabase(db *database.Client) Option {
+	return func(s *Server) {
+		s.DB = db
+	}
+}
+
+// WithoutDatabase sets up the server without a database client, for
+// services that do not use Postgres. It cannot be combined with WithDedup
+// nor WithOutbox.
+func WithoutDatabase() Option {
+	return func(s *Server) {
+		s.noDatabase = true
+	}
+}
+
+// WithPubSub sets the pubsub client instead of connecting a new one.
+func WithPubSub(c *pubsub.Client) Option {
+	return func(s *Server) {
+		s.PubSub = c
+	}
+}
+
+// WithBroker sets the broker pubsub events are received from and messages
+// published to. Without a pubsub client, Create then does not connect to
+// NATS.
+func WithBroker(broker pubsub.Broker) Option {
+	return func(s *Server) {
+		s.Broker = broker
+	}
+}
+
+// WithDedup creates the table of the dedup store used by the Idempotent
+// middleware, and runs the app event removing its expired records.
+func WithDedup() Option {
+	return func(s *Server) {
+		s.dedup = true
+	}
+}
+
+// WithOutbox creates the outbox table, and runs the app events publishing
+// the messages inserted into it and removing the sent ones.
+func WithOutbox() Option {
+	return func(s *Server) {
+		s.outbox = true
+	}
+}
+
+// WithClient makes any other client available to handlers through Client.
+func WithClient(name string, client any) Option {
+	return func(s *Server) {
+		s.clients[name] = client
+	}
+}
+
+// New returns a server configured by opts. Its clients are set up by
+// Create.
+func New(opts ...Option) *Server {
+	s := &Server{
+		Registry: event.NewRegistry(),
+		clients:  map[string]any{},
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Client returns the client given to New with WithClient under name, or nil.
+func (s *Server) Client(name string) any {
+	return s.clients[name]
 }
 
-// Create sets up a server with necessary all clients.
+// Create sets up the clients of the server that were not given to New, and
+// the tables and built-in app events of the dedup store and outbox when
+// enabled.
 // Returns an error if an error occurs.
-func (s *Server) Create(ctx context.Context, config *config.Config) error {
-	var dbClient database.Client
-	if err := dbClient.Init(ctx, config); err != nil {
-		return fmt.Errorf("database client: %w", err)
+func (s *Server) Create(ctx context.Context) error {
+	if s.Config == nil {
+		config, err := config.LoadConfig()
+		if err != nil {
+			return fmt.Errorf("config: %w", err)
+		}
+		s.Config = config
+	}
+
+	if s.DB == nil && !s.noDatabase {
+		var dbClient database.Client
+		if err := dbClient.Init(ctx, s.Config); err != nil {
+			return fmt.Errorf("database client: %w", err)
+		}
+		s.DB = &dbClient
 	}
 
-	var psClient pubsub.Client
-	if err := psClient.Init(ctx, config); err != nil {
-		return fmt.Errorf("pubsub client: %w", err)
+	// A broker given to New replaces the NATS connection
+	if s.Broker == nil {
+		if s.PubSub == nil {
+			var psClient pubsub.Client
+			if err := psClient.Init(ctx, s.Config); err != nil {
+				return fmt.Errorf("pubsub client: %w", err)
+			}
+			s.PubSub = &psClient
+		}
+		s.Broker = s.PubSub.Broker()
 	}
 
-	s.DB = &dbClient
-	s.PubSub = &psClient
-	s.Config = config
+	s.Publisher = pubsub.NewPublisher(s.Broker)
 	s.HTTP = &http.Server{
 		Addr: fmt.Sprintf(":%s", s.Config.Port),
 	}
 
+	return s.registerBuiltins(ctx)
+}
+
+// registerBuiltins creates the tables of the dedup store and the outbox, if
+// enabled, and registers the app events maintaining them.
+func (s *Server) registerBuiltins(ctx context.Context) error {
+	if (s.dedup || s.outbox) && s.DB == nil {
+		return errors.New("the dedup store and the outbox need a database")
+	}
+
+	if s.dedup {
+		if err := s.DB.CreateDedupTable(ctx); err != nil {
+			return fmt.Errorf("dedup: %w", err)
+		}
+		s.registerDedup()
+	}
+
+	if s.outbox {
+		if err := s.DB.CreateOutboxTable(ctx); err != nil {
+			return fmt.Errorf("outbox: %w", err)
+		}
+		s.registerOutbox()
+	}
+
 	return nil
 }
 
+func (s *Server) registerDedup() {
+	s.RegisterApp("DedupCleanup",
+		handler.DedupCleanup{
+			DB:  s.DB,
+			TTL: s.Config.IdempotencyTTL,
+		},
+		event.WithRate(s.Config.IdempotencyCleanupEvery),
+		event.WithLeader(s.DB.NewAdvisoryLock("app_event:DedupCleanup")),
+	)
+}
+
+func (s *Server) registerOutbox() {
+	s.RegisterApp("OutboxRelay",
+		handler.OutboxRelay{
+			ServiceName: s.Config.ServiceName,
+			DB:          s.DB,
+			Publisher:   s.Publisher,
+			BatchSize:   s.Config.OutboxBatchSize,
+			MaxAttempts: s.Config.OutboxMaxAttempts,
+			RetryPolicy: event.RetryPolicy{
+				InitialDelay: s.Config.OutboxRetryDelay,
+				Multiplier:   2,
+				MaxDelay:     s.Config.OutboxMaxRetryDelay,
+			},
+		},
+		event.WithRate(s.Config.OutboxRelayEvery),
+		// Bounds how long the locks on the relayed rows are held
+		event.WithRunTimeout(s.Config.OutboxRelayTimeout),
+	)
+
+	s.RegisterApp("OutboxCleanup",
+		handler.OutboxCleanup{
+			DB:        s.DB,
+			Retention: s.Config.OutboxRetention,
+		},
+		event.WithRate(s.Config.OutboxCleanupEvery),
+		event.WithLeader(s.DB.NewAdvisoryLock("app_event:OutboxCleanup")),
+	)
+}
+
 // Serve starts subscribing for messages.
 // It also makes sure that the server gracefully shuts down on exit.
 // Returns an error if an error occurs.
 func (s *Server) Serve(ctx context.Context, errc chan<- error) {
 	s.addTracingAndMetrics(errc)
 
+	s.subscribeAndListen(ctx, errc)
 	go s.serveHTTP(errc)
-	go s.subscribeAndListen(ctx, errc)
 
 	log.Info("Ready")
 
@@ -82,12 +268,58 @@ func (s *Server) Serve(ctx context.Context, errc chan<- error) {
 func (s *Server) serveHTTP(errc chan<- error) {
 	http.Handle("/metrics", promhttp.Handler())
 	http.HandleFunc("/_healthz", handler.Healthz)
+	http.HandleFunc("/_livez", handler.Livez(s.livenessChecks()))
+	http.HandleFunc("/_readyz", handler.Readyz(s.healthChecks()))
 
 	if err := s.HTTP.ListenAndServe(); err != http.ErrServerClosed {
 		errc <- err
 	}
 }
 
+// livenessChecks returns the checks behind the liveness probe.
+func (s *Server) livenessChecks() *health.Registry {
+	registry := health.NewRegistry(s.Config.HealthCheckTimeout)
+
+	// A closed connection is never reopened, unlike a disconnected one
+	if s.PubSub != nil {
+		registry.Register("nats", health.CheckerFunc(s.PubSub.CheckNotClosed))
+	}
+
+	return registry
+}
+
+// healthChecks returns the checks behind the readiness probe.
+func (s *Server) healthChecks() *health.Registry {
+	registry := health.NewRegistry(s.Config.HealthCheckTimeout)
+
+	if s.DB != nil {
+		registry.Register("database", health.CheckerFunc(s.DB.Ping))
+	}
+	if s.PubSub != nil {
+		registry.Register("nats", health.CheckerFunc(s.PubSub.CheckConnection))
+		registry.Register("jetstream", health.CheckerFunc(s.PubSub.CheckJetStream))
+	}
+	registry.Register("subscriptions", health.CheckerFunc(func(ctx context.Context) error {
+		for i := range s.pubSubEvents {
+			if !s.pubSubEvents[i].Subscribed() {
+				return fmt.Errorf("%s is not subscribed", s.pubSubEvents[i].Name)
+			}
+		}
+		return nil
+	}))
+	registry.RegisterInfo("leaders", func() any {
+		leaders := map[string]bool{}
+		for i := range s.appEvents {
+			if s.appEvents[i].Leader != nil {
+				leaders[s.appEvents[i].Name] = s.appEvents[i].IsLeader()
+			}
+		}
+		return leaders
+	})
+
+	return registry
+}
+
 func (s *Server) addTracingAndMetrics(errc chan<- error) {
 	var err error
 	s.TracerProvider, err = trace.TracerProvider(s.Config)
@@ -103,20 +335,55 @@ func (s *Server) addTracingAndMetrics(errc chan<- error) {
 }
 
 func (s *Server) subscribeAndListen(ctx context.Context, errc chan<- error) {
-	for _, e := range event.GetPubSubEvents(s.DB) {
-		go func(e event.PubSubEvent) {
-			e.SubscribeAndListen(ctx, s.PubSub, errc)
-		}(e)
+	s.pubSubEvents = s.PubSubEvents()
+	for i := range s.pubSubEvents {
+		s.pubSubEvents[i].SubscribeAndListen(ctx, s.Broker, s.Config, errc)
 	}
-	for _, e := range event.GetAppEvents() {
-		go func(e event.AppEvent) {
-			e.SubscribeAndListen(ctx)
-		}(e)
+	s.appEvents = s.AppEvents()
+	for i := range s.appEvents {
+		s.appEvents[i].SubscribeAndListen(ctx, errc)
 	}
 
 }
 
+// shutdown stops the server in order: no new messages are fetched nor app
+// events run, in-flight messages and app event runs get most of the
+// shutdown timeout to finish, the NATS connection is drained within what is
+// left of it so pending acks reach the server, and only then the database,
+// telemetry and HTTP server are closed.
 func (s *Server) shutdown(ctx context.Context) {
+	deadline := time.Now().Add(s.Config.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	// A fifth of the timeout is kept for the drain, to flush the acks and
+	// naks of the messages settled last
+	eventsCtx, cancelEvents := context.WithDeadline(shutdownCtx, deadline.Add(-s.Config.ShutdownTimeout/5))
+	defer cancelEvents()
+
+	var wg sync.WaitGroup
+	for i := range s.pubSubEvents {
+		wg.Add(1)
+		go func(e *event.PubSubEvent) {
+			defer wg.Done()
+			e.Shutdown(eventsCtx)
+		}(&s.pubSubEvents[i])
+	}
+	for i := range s.appEvents {
+		wg.Add(1)
+		go func(e *event.AppEvent) {
+			defer wg.Done()
+			e.Shutdown(eventsCtx)
+		}(&s.appEvents[i])
+	}
+	wg.Wait()
+
+	if s.PubSub != nil {
+		if err := s.PubSub.Drain(shutdownCtx); err != nil {
+			log.Error(err.Error())
+		}
+	}
+
 	if err := s.TracerProvider.Shutdown(ctx); err != nil {
 		log.Error(err.Error())
 	}
@@ -125,8 +392,10 @@ func (s *Server) shutdown(ctx context.Context) {
 		log.Error(err.Error())
 	}
 
-	if err := s.DB.Close(); err != nil {
-		log.Error(err.Error())
+	if s.DB != nil {
+		if err := s.DB.Close(); err != nil {
+			log.Error(err.Error())
+		}
 	}
 
 	if err := s.HTTP.Shutdown(ctx); err != nil {
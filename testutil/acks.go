@@ -0,0 +1,183 @@
+package testutil
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// AckKind is how a delivery was settled.
+type AckKind string
+
+// The kinds of acknowledgement a subscriber sends.
+const (
+	KindAck        AckKind = "+ACK"
+	KindNak        AckKind = "-NAK"
+	KindTerm       AckKind = "+TERM"
+	KindInProgress AckKind = "+WPI"
+)
+
+// Ack is an acknowledgement sent for a delivery of a message.
+type Ack struct {
+	Kind           AckKind
+	Stream         string
+	Consumer       string
+	StreamSequence uint64
+	// NumDelivered is how many times the message was delivered when it
+	// was acknowledged, above 1 for redeliveries.
+	NumDelivered uint64
+}
+
+// Recorder records the acknowledgements sent for the messages of a durable
+// consumer. Subscribers acknowledge by publishing to the reply subject of
+// the delivery, which the recorder listens to alongside the server.
+type Recorder struct {
+	h        *Harness
+	consumer string
+
+	mu   sync.Mutex
+	acks []Ack
+}
+
+// RecordAcks starts recording the acknowledgements for the messages of the
+// durable consumer until the test ends.
+func (h *Harness) RecordAcks(durable string) *Recorder {
+	h.t.Helper()
+
+	r := &Recorder{
+		h:        h,
+		consumer: durable,
+	}
+
+	sub, err := h.Client.Conn.Subscribe("$JS.ACK.>", r.record)
+	if err != nil {
+		h.t.Fatalf("subscribe to acks: %v", err)
+	}
+	if err := h.Client.Conn.Flush(); err != nil {
+		h.t.Fatalf("subscribe to acks: %v", err)
+	}
+	h.t.Cleanup(func() {
+		_ = sub.Unsubscribe()
+	})
+
+	return r
+}
+
+func (r *Recorder) record(msg *nats.Msg) {
+	ack, ok := parseAck(msg)
+	if !ok || ack.Consumer != r.consumer {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.acks = append(r.acks, ack)
+}
+
+// parseAck reads an acknowledgement from its subject, in either the
+// "$JS.ACK.<stream>.<consumer>.<delivered>.<stream seq>..." form or the
+// one with a domain and account hash after "$JS.ACK".
+func parseAck(msg *nats.Msg) (Ack, bool) {
+	tokens := strings.Split(msg.Subject, ".")[2:]
+	switch {
+	case len(tokens) == 7:
+	case len(tokens) >= 9:
+		tokens = tokens[2:]
+	default:
+		return Ack{}, false
+	}
+
+	numDelivered, err := strconv.ParseUint(tokens[2], 10, 64)
+	if err != nil {
+		return Ack{}, false
+	}
+	sequence, err := strconv.ParseUint(tokens[3], 10, 64)
+	if err != nil {
+		return Ack{}, false
+	}
+
+	// Naks may carry a delay after the kind
+	kind, _, _ := bytes.Cut(msg.Data, []byte(" "))
+
+	return Ack{
+		Kind:           AckKind(kind),
+		Stream:         tokens[0],
+		Consumer:       tokens[1],
+		StreamSequence: sequence,
+		NumDelivered:   numDelivered,
+	}, true
+}
+
+// Acks returns the acknowledgements recorded so far, in order.
+func (r *Recorder) Acks() []Ack {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Ack(nil), r.acks...)
+}
+
+// Count returns how many acknowledgements of the kind were recorded.
+func (r *Recorder) Count(kind AckKind) int {
+	n := 0
+	for _, ack := range r.Acks() {
+		if ack.Kind == kind {
+			n++
+		}
+	}
+
+	return n
+}
+
+// AssertAcked waits until n messages were acked.
+func (r *Recorder) AssertAcked(n int) {
+	r.h.t.Helper()
+	r.assertCount(KindAck, n)
+}
+
+// AssertNacked waits until n deliveries were nacked.
+func (r *Recorder) AssertNacked(n int) {
+	r.h.t.Helper()
+	r.assertCount(KindNak, n)
+}
+
+// AssertTerminated waits until n messages were terminated.
+func (r *Recorder) AssertTerminated(n int) {
+	r.h.t.Helper()
+	r.assertCount(KindTerm, n)
+}
+
+// assertCount waits until n acknowledgements of the kind were recorded and
+// fails if more come within a short grace period.
+func (r *Recorder) assertCount(kind AckKind, n int) {
+	r.h.t.Helper()
+
+	r.h.eventually(strconv.Itoa(n)+" "+string(kind), func() bool {
+		return r.Count(kind) >= n
+	})
+
+	time.Sleep(50 * time.Millisecond)
+	if got := r.Count(kind); got != n {
+		r.h.t.Fatalf("got %d %s, want %d: %+v", got, kind, n, r.Acks())
+	}
+}
+
+// AssertDelivered waits until the message with the stream sequence was
+// acknowledged after being delivered n times, n above 1 meaning it was
+// redelivered.
+func (r *Recorder) AssertDelivered(streamSequence uint64, n uint64) {
+	r.h.t.Helper()
+
+	r.h.eventually("stream sequence "+strconv.FormatUint(streamSequence, 10)+" to be delivered "+strconv.FormatUint(n, 10)+" times", func() bool {
+		for _, ack := range r.Acks() {
+			if ack.StreamSequence == streamSequence && ack.NumDelivered >= n {
+				return true
+			}
+		}
+		return false
+	})
+}
@@ -0,0 +1,77 @@
+package testutil
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Messages returns the messages stored on the subject, in order.
+func (h *Harness) Messages(subject string) []*nats.Msg {
+	h.t.Helper()
+
+	stream, err := h.Client.StreamNameBySubject(subject)
+	if err != nil {
+		h.t.Fatalf("find stream of subject %s: %v", subject, err)
+	}
+
+	info, err := h.Client.StreamInfo(stream, &nats.StreamInfoRequest{SubjectsFilter: subject})
+	if err != nil {
+		h.t.Fatalf("stream info %s: %v", stream, err)
+	}
+
+	var count uint64
+	for _, n := range info.State.Subjects {
+		count += n
+	}
+	if count == 0 {
+		return nil
+	}
+
+	sub, err := h.Client.SubscribeSync(subject, nats.OrderedConsumer(), nats.DeliverAll())
+	if err != nil {
+		h.t.Fatalf("subscribe to %s: %v", subject, err)
+	}
+	defer func() {
+		_ = sub.Unsubscribe()
+	}()
+
+	msgs := make([]*nats.Msg, 0, count)
+	for uint64(len(msgs)) < count {
+		msg, err := sub.NextMsg(Timeout)
+		if err != nil {
+			h.t.Fatalf("read %s: %v", subject, err)
+		}
+		msgs = append(msgs, msg)
+	}
+
+	return msgs
+}
+
+// DeadLetterSubject returns the default dead letter subject of the durable
+// consumer.
+func (h *Harness) DeadLetterSubject(durable string) string {
+	return fmt.Sprintf("%s.%s", h.Config.NatsDeadLetterStream, durable)
+}
+
+// AssertDeadLettered waits until n messages of the durable consumer were
+// moved to its default dead letter subject and returns them.
+func (h *Harness) AssertDeadLettered(durable string, n int) []*nats.Msg {
+	h.t.Helper()
+
+	subject := h.DeadLetterSubject(durable)
+
+	var msgs []*nats.Msg
+	h.eventually(fmt.Sprintf("%d messages on %s", n, subject), func() bool {
+		msgs = h.Messages(subject)
+		return len(msgs) >= n
+	})
+
+	time.Sleep(50 * time.Millisecond)
+	if msgs = h.Messages(subject); len(msgs) != n {
+		h.t.Fatalf("got %d messages on %s, want %d", len(msgs), subject, n)
+	}
+
+	return msgs
+}
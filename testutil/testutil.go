@@ -0,0 +1,225 @@
+// Package testutil runs subscribers end to end against an in-process NATS
+// JetStream server, for tests.
+//
+// A Harness starts the server on a random port with its store in a
+// temporary directory, connects a pubsub.Client to it and stops everything
+// when the test ends. Events are started with Listen, messages published
+// with Publish, and how they were settled asserted with a Recorder.
+//
+// The harness sets the required config variables of the test process that
+// are not set yet, so it cannot be used by parallel tests.
+package testutil
+
+import (
+	"context"
+	"os"
+	"template-subscriber-go/client/pubsub"
+	"template-subscriber-go/config"
+	"template-subscriber-go/server"
+	"template-subscriber-go/server/event"
+	"testing"
+	"time"
+
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"google.golang.org/protobuf/proto"
+)
+
+// Timeout bounds how long the helpers wait for something to happen before
+// failing the test.
+var Timeout = 5 * time.Second
+
+// Harness holds an in-process NATS JetStream server and the clients
+// connected to it.
+type Harness struct {
+	t testing.TB
+
+	NATS      *natsserver.Server
+	URL       string
+	Config    *config.Config
+	Client    *pubsub.Client
+	Publisher *pubsub.Publisher
+}
+
+// New starts a NATS JetStream server and connects a pubsub.Client to it.
+// The streams are provisioned from the config as in production, plus the
+// ones added with AddStream.
+func New(t testing.TB) *Harness {
+	t.Helper()
+
+	ns, err := natsserver.NewServer(&natsserver.Options{
+		Host:      "127.0.0.1",
+		Port:      natsserver.RANDOM_PORT,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatalf("create nats server: %v", err)
+	}
+
+	go ns.Start()
+	t.Cleanup(func() {
+		ns.Shutdown()
+		ns.WaitForShutdown()
+	})
+	if !ns.ReadyForConnections(Timeout) {
+		t.Fatal("nats server not ready for connections")
+	}
+
+	h := &Harness{
+		t:    t,
+		NATS: ns,
+		URL:  ns.ClientURL(),
+	}
+	h.Config = h.loadConfig()
+
+	var client pubsub.Client
+	if err := client.Init(context.Background(), h.Config); err != nil {
+		t.Fatalf("init pubsub client: %v", err)
+	}
+	t.Cleanup(client.Conn.Close)
+
+	h.Client = &client
+	h.Publisher = pubsub.NewPublisher(client.Broker())
+
+	return h
+}
+
+// loadConfig loads the config the way the service does, pointing it at the
+// server and filling the other required variables with test values.
+func (h *Harness) loadConfig() *config.Config {
+	h.t.Helper()
+
+	h.t.Setenv("NATS_URL", h.URL)
+	for _, key := range []string{"SERVICE_NAME", "ENVIRONMENT", "DATABASE_USER", "DATABASE_PASSWORD"} {
+		if _, ok := os.LookupEnv(key); !ok {
+			h.t.Setenv(key, "test")
+		}
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		h.t.Fatalf("load config: %v", err)
+	}
+
+	return cfg
+}
+
+// NewServer returns a server using the harness config and pubsub client,
+// set up with Create. The server has no database unless opts give it one
+// with server.WithDatabase, so it needs no Postgres.
+func (h *Harness) NewServer(opts ...server.Option) *server.Server {
+	h.t.Helper()
+
+	opts = append([]server.Option{
+		server.WithConfig(h.Config),
+		server.WithPubSub(h.Client),
+		server.WithoutDatabase(),
+	}, opts...)
+
+	s := server.New(opts...)
+	if err := s.Create(context.Background()); err != nil {
+		h.t.Fatalf("create server: %v", err)
+	}
+
+	return s
+}
+
+// Listen starts the pubsub events of the registry against the harness
+// server and waits until they are all subscribed. They are shut down when
+// the test ends.
+func (h *Harness) Listen(registry *event.Registry) {
+	h.t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+
+	events := registry.PubSubEvents()
+	for i := range events {
+		events[i].SubscribeAndListen(ctx, h.Client.Broker(), h.Config, errc)
+	}
+
+	h.t.Cleanup(func() {
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), Timeout)
+		defer cancelShutdown()
+
+		for i := range events {
+			events[i].Shutdown(shutdownCtx)
+		}
+		cancel()
+	})
+
+	h.eventually("events to subscribe", func() bool {
+		select {
+		case err := <-errc:
+			h.t.Fatalf("listen: %v", err)
+		default:
+		}
+
+		for i := range events {
+			if !events[i].Subscribed() {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// AddStream creates a stream holding the subjects.
+func (h *Harness) AddStream(name string, subjects ...string) {
+	h.t.Helper()
+
+	_, err := h.Client.AddStream(&nats.StreamConfig{
+		Name:     name,
+		Subjects: subjects,
+	})
+	if err != nil {
+		h.t.Fatalf("add stream %s: %v", name, err)
+	}
+}
+
+// Publish publishes a fixture through the Publisher and returns its ack.
+func (h *Harness) Publish(subject string, msg proto.Message, opts ...pubsub.PublishOption) *nats.PubAck {
+	h.t.Helper()
+
+	ack, err := h.Publisher.Publish(context.Background(), subject, msg, opts...)
+	if err != nil {
+		h.t.Fatalf("publish fixture: %v", err)
+	}
+
+	return ack
+}
+
+// PublishData publishes a raw fixture with the given headers, which may be
+// nil, and returns its ack.
+func (h *Harness) PublishData(subject string, data []byte, header nats.Header) *nats.PubAck {
+	h.t.Helper()
+
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	for key, values := range header {
+		msg.Header[key] = values
+	}
+
+	ack, err := h.Client.PublishMsg(msg)
+	if err != nil {
+		h.t.Fatalf("publish fixture: %v", err)
+	}
+
+	return ack
+}
+
+// eventually waits until cond holds, failing the test after Timeout.
+func (h *Harness) eventually(what string, cond func() bool) {
+	h.t.Helper()
+
+	deadline := time.Now().Add(Timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			h.t.Fatalf("timed out after %s waiting for %s", Timeout, what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,192 @@
+package testutil_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"template-subscriber-go/client/pubsub"
+	"template-subscriber-go/example/pb/fakeapi"
+	"template-subscriber-go/server/event"
+	"template-subscriber-go/testutil"
+	"testing"
+	"time"
+)
+
+// handleFake lets a function be used as the ProtoHandler of FakeData.
+type handleFake func(ctx context.Context, msg *fakeapi.FakeData) error
+
+func (f handleFake) Handle(ctx context.Context, msg *fakeapi.FakeData) error {
+	return f(ctx, msg)
+}
+
+// register registers the Example event handling the messages of the example
+// stream with h.
+func register(h handleFake, opts ...event.PubSubOption) *event.Registry {
+	registry := event.NewRegistry()
+	registry.RegisterPubSub("Example", "example", "example",
+		event.TypedHandler[*fakeapi.FakeData]{Handler: h},
+		opts...,
+	)
+
+	return registry
+}
+
+// fastRetries redelivers failed messages right away.
+var fastRetries = event.WithRetryPolicy(event.RetryPolicy{
+	InitialDelay: 10 * time.Millisecond,
+})
+
+func TestAck(t *testing.T) {
+	h := testutil.New(t)
+	acks := h.RecordAcks("example")
+
+	var received atomic.Bool
+	h.Listen(register(func(_ context.Context, msg *fakeapi.FakeData) error {
+		received.Store(msg.IsFake)
+		return nil
+	}))
+
+	h.Publish("example", &fakeapi.FakeData{IsFake: true})
+
+	acks.AssertAcked(1)
+	if !received.Load() {
+		t.Error("handler did not receive the decoded message")
+	}
+}
+
+func TestNakAndRedelivery(t *testing.T) {
+	h := testutil.New(t)
+	acks := h.RecordAcks("example")
+
+	var calls atomic.Int32
+	h.Listen(register(func(context.Context, *fakeapi.FakeData) error {
+		if calls.Add(1) == 1 {
+			return errors.New("temporary failure")
+		}
+		return nil
+	}, fastRetries))
+
+	ack := h.Publish("example", &fakeapi.FakeData{IsFake: true})
+
+	acks.AssertNacked(1)
+	acks.AssertAcked(1)
+	acks.AssertDelivered(ack.Sequence, 2)
+}
+
+func TestTerm(t *testing.T) {
+	h := testutil.New(t)
+	acks := h.RecordAcks("example")
+
+	h.Listen(register(func(context.Context, *fakeapi.FakeData) error {
+		panic("unexpected data")
+	}, func(e *event.PubSubEvent) {
+		e.PanicPolicy = event.PanicPolicyTerm
+	}))
+
+	h.Publish("example", &fakeapi.FakeData{IsFake: true})
+
+	acks.AssertTerminated(1)
+	if n := acks.Count(testutil.KindAck); n != 0 {
+		t.Errorf("got %d acks, want none", n)
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	h := testutil.New(t)
+	acks := h.RecordAcks("example")
+
+	h.Listen(register(func(context.Context, *fakeapi.FakeData) error {
+		return errors.New("permanent failure")
+	}, fastRetries, event.WithMaxDeliver(3)))
+
+	ack := h.Publish("example", &fakeapi.FakeData{IsFake: true})
+
+	msgs := h.AssertDeadLettered("example", 1)
+	acks.AssertNacked(2)
+	acks.AssertTerminated(1)
+
+	header := msgs[0].Header
+	if got := header.Get(event.HeaderDeadLetterDeliveries); got != "3" {
+		t.Errorf("got %s deliveries, want 3", got)
+	}
+	if got := header.Get(event.HeaderDeadLetterReason); got != "permanent failure" {
+		t.Errorf("got reason %q, want %q", got, "permanent failure")
+	}
+	if got, want := header.Get(event.HeaderDeadLetterSequence), strconv.FormatUint(ack.Sequence, 10); got != want {
+		t.Errorf("got stream sequence %s, want %s", got, want)
+	}
+}
+
+func TestBackOff(t *testing.T) {
+	h := testutil.New(t)
+	acks := h.RecordAcks("example")
+
+	// Without a retry policy, failed messages are redelivered by the server
+	// after the backoff delays
+	h.Listen(register(func(context.Context, *fakeapi.FakeData) error {
+		return errors.New("permanent failure")
+	}, event.WithMaxDeliver(3), event.WithTimeout(50*time.Millisecond), func(e *event.PubSubEvent) {
+		e.BackOff = []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}
+	}))
+
+	ack := h.Publish("example", &fakeapi.FakeData{IsFake: true})
+
+	msgs := h.AssertDeadLettered("example", 1)
+	acks.AssertDelivered(ack.Sequence, 3)
+	acks.AssertTerminated(1)
+
+	if got := msgs[0].Header.Get(event.HeaderDeadLetterDeliveries); got != "3" {
+		t.Errorf("got %s deliveries, want 3", got)
+	}
+}
+
+func TestNewServerWithoutDatabase(t *testing.T) {
+	h := testutil.New(t)
+
+	s := h.NewServer()
+	if s.DB != nil {
+		t.Error("server has a database client, want none")
+	}
+	if s.Broker == nil || s.Publisher == nil {
+		t.Fatal("server has no broker or publisher")
+	}
+
+	acks := h.RecordAcks("example")
+	s.RegisterPubSub("Example", "example", "example",
+		event.TypedHandler[*fakeapi.FakeData]{
+			Handler: handleFake(func(context.Context, *fakeapi.FakeData) error {
+				return nil
+			}),
+		},
+	)
+	h.Listen(s.Registry)
+
+	if _, err := s.Publisher.Publish(context.Background(), "example", &fakeapi.FakeData{IsFake: true}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	acks.AssertAcked(1)
+}
+
+func TestCheckNotClosed(t *testing.T) {
+	h := testutil.New(t)
+
+	var client pubsub.Client
+	if err := client.Init(context.Background(), h.Config); err != nil {
+		t.Fatalf("init pubsub client: %v", err)
+	}
+	if err := client.CheckNotClosed(context.Background()); err != nil {
+		t.Fatalf("check connected client: %v", err)
+	}
+
+	client.Conn.Close()
+
+	deadline := time.Now().Add(testutil.Timeout)
+	for client.CheckNotClosed(context.Background()) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("check passes on a closed connection")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}